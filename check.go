@@ -0,0 +1,370 @@
+package v2
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/soedomoto/db2gorm/properties"
+	"gorm.io/gen"
+)
+
+// Drift is a difference between the database schema and the generated code,
+// Added/Removed are seen from the database side
+type Drift struct {
+	Database string
+	Table    string
+	Column   string
+	Kind     string // added || removed || changed || missing
+	Detail   string
+}
+
+func (d Drift) String() string {
+	target := d.Table
+	if d.Column != "" {
+		target += "." + d.Column
+	}
+	if d.Detail == "" {
+		return fmt.Sprintf("[%s] %s %s", d.Database, target, d.Kind)
+	}
+	return fmt.Sprintf("[%s] %s %s: %s", d.Database, target, d.Kind, d.Detail)
+}
+
+type generatedColumn struct {
+	Name       string
+	Type       string
+	PrimaryKey bool
+	NotNull    bool
+}
+
+type generatedIndex struct {
+	Name    string
+	Unique  bool
+	Columns []string
+}
+
+func (idx generatedIndex) String() string {
+	kind := "index"
+	if idx.Unique {
+		kind = "uniqueIndex"
+	}
+	return fmt.Sprintf("%s %s(%s)", kind, idx.Name, strings.Join(idx.Columns, ","))
+}
+
+type generatedTable struct {
+	Name    string
+	File    string
+	Columns []*generatedColumn
+	Indexes []generatedIndex
+}
+
+// splitGormTag splits a gorm tag into its key/value settings, keeping repeated keys
+func splitGormTag(tag string) [][2]string {
+	settings := make([][2]string, 0)
+	for _, s := range strings.Split(tag, ";") {
+		if strings.TrimSpace(s) == "" {
+			continue
+		}
+		kv := strings.SplitN(s, ":", 2)
+		if len(kv) == 1 {
+			kv = append(kv, "")
+		}
+		settings = append(settings, [2]string{strings.TrimSpace(kv[0]), kv[1]})
+	}
+	return settings
+}
+
+type indexPart struct {
+	column   string
+	priority int
+}
+
+func groupIndexes(parts map[string][]indexPart, unique map[string]bool) []generatedIndex {
+	indexes := make([]generatedIndex, 0, len(parts))
+	for name, ps := range parts {
+		sort.SliceStable(ps, func(i, j int) bool { return ps[i].priority < ps[j].priority })
+		idx := generatedIndex{Name: name, Unique: unique[name]}
+		for _, p := range ps {
+			idx.Columns = append(idx.Columns, p.column)
+		}
+		indexes = append(indexes, idx)
+	}
+	sort.Slice(indexes, func(i, j int) bool { return indexes[i].Name < indexes[j].Name })
+	return indexes
+}
+
+// loadGeneratedTables parses the gen model package in dir back into tables
+func loadGeneratedTables(dir string) (map[string]*generatedTable, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.gen.go"))
+	if err != nil {
+		return nil, err
+	}
+
+	tables := make(map[string]*generatedTable)
+	for _, file := range files {
+		f, err := parser.ParseFile(token.NewFileSet(), file, nil, 0)
+		if err != nil {
+			return nil, err
+		}
+
+		tableNames := make(map[string]string) // struct name -> table name
+		structs := make(map[string]*ast.StructType)
+		for _, decl := range f.Decls {
+			genDecl, ok := decl.(*ast.GenDecl)
+			if !ok {
+				continue
+			}
+			for _, spec := range genDecl.Specs {
+				switch spec := spec.(type) {
+				case *ast.ValueSpec:
+					for i, name := range spec.Names {
+						if !strings.HasPrefix(name.Name, "TableName") || i >= len(spec.Values) {
+							continue
+						}
+						if lit, ok := spec.Values[i].(*ast.BasicLit); ok && lit.Kind == token.STRING {
+							tableNames[strings.TrimPrefix(name.Name, "TableName")], _ = strconv.Unquote(lit.Value)
+						}
+					}
+				case *ast.TypeSpec:
+					if st, ok := spec.Type.(*ast.StructType); ok {
+						structs[spec.Name.Name] = st
+					}
+				}
+			}
+		}
+
+		for structName, tableName := range tableNames {
+			st, ok := structs[structName]
+			if !ok {
+				continue
+			}
+
+			table := &generatedTable{Name: tableName, File: filepath.Base(file)}
+			parts := make(map[string][]indexPart)
+			unique := make(map[string]bool)
+			for _, fl := range st.Fields.List {
+				if fl.Tag == nil {
+					continue
+				}
+				rawTag, _ := strconv.Unquote(fl.Tag.Value)
+
+				column := &generatedColumn{}
+				for _, kv := range splitGormTag(reflect.StructTag(rawTag).Get("gorm")) {
+					switch kv[0] {
+					case "column":
+						column.Name = kv[1]
+					case "type":
+						column.Type = kv[1]
+					case "primaryKey":
+						column.PrimaryKey = true
+					case "not null":
+						column.NotNull = true
+					case "index", "uniqueIndex":
+						name, priority := kv[1], 0
+						if i := strings.Index(name, ",priority:"); i >= 0 {
+							priority, _ = strconv.Atoi(name[i+len(",priority:"):])
+							name = name[:i]
+						}
+						parts[name] = append(parts[name], indexPart{column.Name, priority})
+						unique[name] = kv[0] == "uniqueIndex"
+					}
+				}
+				if column.Name != "" {
+					table.Columns = append(table.Columns, column)
+				}
+			}
+			table.Indexes = groupIndexes(parts, unique)
+			tables[tableName] = table
+		}
+	}
+
+	return tables, nil
+}
+
+// expectedIndexes reduces the database indexes the way gen tags them: primary key
+// indexes are skipped and a column keeps only its last index and last unique index
+func expectedIndexes(t *SnapshotTable) []generatedIndex {
+	type tagged struct {
+		name     string
+		priority int
+	}
+	lastIndex := make(map[string]tagged)
+	lastUnique := make(map[string]tagged)
+	unique := make(map[string]bool)
+	for _, idx := range t.Indexes {
+		if idx.PrimaryKey != nil && *idx.PrimaryKey {
+			continue
+		}
+		isUnique := idx.Unique != nil && *idx.Unique
+		unique[idx.Name] = isUnique
+		for i, c := range idx.Columns {
+			if isUnique {
+				lastUnique[c] = tagged{idx.Name, i + 1}
+			} else {
+				lastIndex[c] = tagged{idx.Name, i + 1}
+			}
+		}
+	}
+
+	parts := make(map[string][]indexPart)
+	for _, m := range []map[string]tagged{lastIndex, lastUnique} {
+		for c, tg := range m {
+			parts[tg.name] = append(parts[tg.name], indexPart{c, tg.priority})
+		}
+	}
+	return groupIndexes(parts, unique)
+}
+
+// diffTable compares live with the parsed model code, the type and index tags only
+// when gen emits them, see field_with_type_tag and field_with_index_tag
+func diffTable(d *properties.Databases, config *gen.Config, live *SnapshotTable, code *generatedTable) []Drift {
+	drifts := make([]Drift, 0)
+
+	codeColumns := make(map[string]*generatedColumn)
+	for _, c := range code.Columns {
+		codeColumns[c.Name] = c
+	}
+	liveColumns := make(map[string]bool)
+	for _, c := range live.Columns {
+		liveColumns[c.Name] = true
+
+		cc, ok := codeColumns[c.Name]
+		if !ok {
+			drifts = append(drifts, Drift{Database: d.Name, Table: live.Name, Column: c.Name, Kind: "added"})
+			continue
+		}
+
+		columnType := c.DatabaseType
+		if c.ColumnType != nil {
+			columnType = *c.ColumnType
+		}
+		if config.FieldWithTypeTag && columnType != cc.Type {
+			drifts = append(drifts, Drift{Database: d.Name, Table: live.Name, Column: c.Name, Kind: "changed",
+				Detail: fmt.Sprintf("type %s -> %s", cc.Type, columnType)})
+		}
+
+		isPk := c.PrimaryKey != nil && *c.PrimaryKey
+		if isPk != cc.PrimaryKey {
+			drifts = append(drifts, Drift{Database: d.Name, Table: live.Name, Column: c.Name, Kind: "changed",
+				Detail: fmt.Sprintf("primary key %t -> %t", cc.PrimaryKey, isPk)})
+		} else if !isPk {
+			notNull := c.Nullable != nil && !*c.Nullable
+			if notNull != cc.NotNull {
+				drifts = append(drifts, Drift{Database: d.Name, Table: live.Name, Column: c.Name, Kind: "changed",
+					Detail: fmt.Sprintf("nullable %t -> %t", !cc.NotNull, !notNull)})
+			}
+		}
+	}
+	for _, c := range code.Columns {
+		if !liveColumns[c.Name] {
+			drifts = append(drifts, Drift{Database: d.Name, Table: live.Name, Column: c.Name, Kind: "removed"})
+		}
+	}
+
+	if !config.FieldWithIndexTag {
+		return drifts
+	}
+
+	codeIndexes := make(map[string]generatedIndex)
+	for _, idx := range code.Indexes {
+		codeIndexes[idx.Name] = idx
+	}
+	liveIndexes := make(map[string]bool)
+	for _, idx := range expectedIndexes(live) {
+		liveIndexes[idx.Name] = true
+
+		ci, ok := codeIndexes[idx.Name]
+		if !ok {
+			drifts = append(drifts, Drift{Database: d.Name, Table: live.Name, Kind: "added", Detail: idx.String()})
+		} else if ci.String() != idx.String() {
+			drifts = append(drifts, Drift{Database: d.Name, Table: live.Name, Kind: "changed",
+				Detail: fmt.Sprintf("%s -> %s", ci, idx)})
+		}
+	}
+	for _, idx := range code.Indexes {
+		if !liveIndexes[idx.Name] {
+			drifts = append(drifts, Drift{Database: d.Name, Table: live.Name, Kind: "removed", Detail: idx.String()})
+		}
+	}
+
+	return drifts
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// Check compares the database schema with the code already generated under out_path,
+// an empty result means the generated code is up to date
+func (g *generator) Check() ([]Drift, error) {
+	err := g.ConnectDb()
+	if err != nil {
+		return nil, err
+	}
+
+	drifts := make([]Drift, 0)
+	for _, d := range g.config.Databases {
+		config, err := GenConfig(d)
+		if err != nil {
+			return nil, fmt.Errorf("check %s: %w", d.Name, err)
+		}
+
+		m := &migrator{d.Db}
+		tables, err := m.FilterTables(d)
+		if err != nil {
+			return nil, fmt.Errorf("check %s: %w", d.Name, err)
+		}
+
+		live, err := m.Snapshot(tables)
+		if err != nil {
+			return nil, fmt.Errorf("check %s: %w", d.Name, err)
+		}
+
+		code, err := loadGeneratedTables(filepath.Join(d.OutPath, d.Gen.ModelPkg()))
+		if err != nil {
+			return nil, fmt.Errorf("check %s: %w", d.Name, err)
+		}
+
+		liveTables := make(map[string]bool)
+		for _, t := range live.Tables {
+			liveTables[t.Name] = true
+
+			ct, ok := code[t.Name]
+			if !ok {
+				drifts = append(drifts, Drift{Database: d.Name, Table: t.Name, Kind: "added"})
+				continue
+			}
+			drifts = append(drifts, diffTable(d, &config, t, ct)...)
+
+			if !fileExists(filepath.Join(d.OutPath, "orm", ct.File)) {
+				drifts = append(drifts, Drift{Database: d.Name, Table: t.Name, Kind: "missing",
+					Detail: filepath.Join(d.OutPath, "orm", ct.File)})
+			}
+			if d.Dataloader && !fileExists(filepath.Join(d.OutPath, "dataloader", t.Name+".gen.go")) {
+				drifts = append(drifts, Drift{Database: d.Name, Table: t.Name, Kind: "missing",
+					Detail: filepath.Join(d.OutPath, "dataloader", t.Name+".gen.go")})
+			}
+		}
+
+		removed := make([]string, 0)
+		for name := range code {
+			if !liveTables[name] {
+				removed = append(removed, name)
+			}
+		}
+		sort.Strings(removed)
+		for _, name := range removed {
+			drifts = append(drifts, Drift{Database: d.Name, Table: name, Kind: "removed"})
+		}
+	}
+
+	return drifts, nil
+}
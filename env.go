@@ -0,0 +1,107 @@
+package v2
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/soedomoto/db2gorm/properties"
+	"gopkg.in/yaml.v3"
+)
+
+// envRef matches ${NAME} and ${NAME:-default}, a bare $NAME is left untouched
+// because DSN passwords may contain $
+var envRef = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)(:-([^}]*))?\}`)
+
+// expandEnv replaces every ${NAME} and ${NAME:-default} in s, the default is used
+// when NAME is unset or empty
+func expandEnv(s string) (string, error) {
+	var err error
+	expanded := envRef.ReplaceAllStringFunc(s, func(ref string) string {
+		m := envRef.FindStringSubmatch(ref)
+		if v := os.Getenv(m[1]); v != "" {
+			return v
+		}
+		if m[2] != "" {
+			return m[3]
+		}
+		if err == nil {
+			err = fmt.Errorf("environment variable %s is not set", m[1])
+		}
+		return ref
+	})
+	return expanded, err
+}
+
+// expandEnvNode expands the scalars of a yaml document, so references in comments
+// are never looked at. An expanded scalar is resolved again as if its value was
+// written in place, ${DATALOADER:-true} decodes into a bool, and keeps its line
+func expandEnvNode(n *yaml.Node) error {
+	switch n.Kind {
+	case yaml.DocumentNode, yaml.SequenceNode:
+		for _, c := range n.Content {
+			if err := expandEnvNode(c); err != nil {
+				return err
+			}
+		}
+	case yaml.MappingNode:
+		// a database generating from its snapshot only needs the dsn to take a new
+		// snapshot, the reference is left for databaseDSN to report then
+		snapshot := ""
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			if n.Content[i].Value == "snapshot" {
+				snapshot = n.Content[i+1].Value
+			}
+		}
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			k, v := n.Content[i], n.Content[i+1]
+			err := expandEnvNode(v)
+			if err != nil && k.Value == "dsn" && snapshot != "" {
+				continue
+			}
+			if err != nil {
+				return fmt.Errorf("%s: %w", k.Value, err)
+			}
+		}
+	case yaml.ScalarNode:
+		expanded, err := expandEnv(n.Value)
+		if err != nil {
+			return fmt.Errorf("line %d: %w", n.Line, err)
+		}
+		if expanded != n.Value {
+			n.Value, n.Tag, n.Style = expanded, "", 0
+		}
+	}
+	return nil
+}
+
+// databaseDSN returns the dsn of d. LoadConfigFile resolves it, except for the
+// databases with a snapshot whose dsn_file and references are only read here
+func databaseDSN(d *properties.Databases) (string, error) {
+	if d.Snapshot == "" {
+		return d.DSN, nil
+	}
+	if d.DSNFile != "" {
+		return readDSNFile(d.DSNFile)
+	}
+	dsn, err := expandEnv(d.DSN)
+	if err != nil {
+		return "", fmt.Errorf("dsn: %w", err)
+	}
+	return dsn, nil
+}
+
+// readDSNFile reads a DSN from a mounted secret file, surrounding whitespace is trimmed
+func readDSNFile(path string) (string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("dsn_file: %w", err)
+	}
+
+	dsn := strings.TrimSpace(string(content))
+	if dsn == "" {
+		return "", fmt.Errorf("dsn_file %s is empty", path)
+	}
+	return dsn, nil
+}
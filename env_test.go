@@ -0,0 +1,124 @@
+package v2
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/soedomoto/db2gorm/properties"
+)
+
+// loadConfig writes content to a db2gorm.yml of its own and loads it
+func loadConfig(t *testing.T, content string) (*properties.Databases, error) {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "db2gorm.yml")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	props, err := LoadConfigFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return props.Databases[0], nil
+}
+
+func TestLoadConfigFileEnv(t *testing.T) {
+	t.Setenv("DB2GORM_TEST_DSN", "file:env.db")
+	t.Setenv("DB2GORM_TEST_MODULE", "")
+	t.Setenv("DB2GORM_TEST_DATALOADER", "")
+	t.Setenv("DB2GORM_TEST_MAX_BATCH", "")
+
+	d, err := loadConfig(t, `# ${DB2GORM_TEST_COMMENT} is never looked at
+databases:
+  - name: Env
+    dsn: ${DB2GORM_TEST_DSN}
+    module_name: ${DB2GORM_TEST_MODULE:-example.com/env}
+    dataloader: ${DB2GORM_TEST_DATALOADER:-true}
+    dataloader_options:
+      max_batch: ${DB2GORM_TEST_MAX_BATCH:-500}
+      cache_ttl: ${DB2GORM_TEST_CACHE_TTL:-1m}
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.DSN != "file:env.db" || d.ModuleName != "example.com/env" {
+		t.Errorf("got dsn %q, module_name %q", d.DSN, d.ModuleName)
+	}
+	if !d.Dataloader || d.DataloaderOptions.MaxBatch != 500 || d.DataloaderOptions.CacheTTL != time.Minute {
+		t.Errorf("got dataloader %v, max_batch %d, cache_ttl %v", d.Dataloader, d.DataloaderOptions.MaxBatch, d.DataloaderOptions.CacheTTL)
+	}
+}
+
+func TestLoadConfigFileEnvErrors(t *testing.T) {
+	t.Setenv("DB2GORM_TEST_DSN", "")
+	t.Setenv("DB2GORM_TEST_MAX_BATCH", "many")
+
+	// the lines are the ones of the file written, not of a re-encoded document
+	for _, c := range []struct {
+		name, content, want string
+	}{
+		{"missing variable", `databases:
+  - name: Env
+
+    dsn: ${DB2GORM_TEST_DSN}
+`, "line 4: environment variable DB2GORM_TEST_DSN is not set"},
+		{"not an int", `databases:
+  - name: Env
+    dsn: file:env.db
+    # the batch size
+    dataloader_options:
+      max_batch: ${DB2GORM_TEST_MAX_BATCH}
+`, "line 6: cannot unmarshal !!str `many` into int"},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			_, err := loadConfig(t, c.content)
+			if err == nil || !strings.Contains(err.Error(), c.want) {
+				t.Errorf("got %v, want %q", err, c.want)
+			}
+		})
+	}
+}
+
+func TestLoadConfigFileSnapshotDSN(t *testing.T) {
+	t.Setenv("DB2GORM_TEST_DSN", "")
+
+	// the dsn is only needed to take a new snapshot
+	d, err := loadConfig(t, `databases:
+  - name: Env
+    snapshot: schema.yml
+    dsn: ${DB2GORM_TEST_DSN}
+    module_name: example.com/env
+`)
+	if err != nil || d.DSN != "${DB2GORM_TEST_DSN}" {
+		t.Errorf("got %+v, %v", d, err)
+	}
+}
+
+func TestLoadConfigFileDSNFile(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "dsn"), []byte("  file:secret.db\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("DB2GORM_TEST_SECRETS", dir)
+
+	d, err := loadConfig(t, `databases:
+  - name: Env
+    dsn_file: ${DB2GORM_TEST_SECRETS}/dsn
+    module_name: example.com/env
+`)
+	if err != nil || d.DSN != "file:secret.db" {
+		t.Errorf("got %+v, %v", d, err)
+	}
+
+	_, err = loadConfig(t, `databases:
+  - name: Env
+    dsn: file:env.db
+    dsn_file: ${DB2GORM_TEST_SECRETS}/dsn
+`)
+	if err == nil || !strings.Contains(err.Error(), "dsn and dsn_file cannot be used together") {
+		t.Errorf("dsn and dsn_file: got %v", err)
+	}
+}
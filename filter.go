@@ -0,0 +1,105 @@
+package v2
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/soedomoto/db2gorm/properties"
+)
+
+// tablePattern matches a table name with a glob (tmp_*) or, when wrapped in
+// slashes, a regular expression (/^audit_.*$/)
+type tablePattern struct {
+	glob string
+	re   *regexp.Regexp
+}
+
+func compileTablePattern(pattern string) (*tablePattern, error) {
+	pattern = strings.TrimSpace(pattern)
+	if len(pattern) > 1 && strings.HasPrefix(pattern, "/") && strings.HasSuffix(pattern, "/") {
+		re, err := regexp.Compile(pattern[1 : len(pattern)-1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid table pattern %q: %w", pattern, err)
+		}
+		return &tablePattern{re: re}, nil
+	}
+
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, fmt.Errorf("invalid table pattern %q: %w", pattern, err)
+	}
+	return &tablePattern{glob: pattern}, nil
+}
+
+func (p *tablePattern) Match(tableName string) bool {
+	if p.re != nil {
+		return p.re.MatchString(tableName)
+	}
+	matched, _ := path.Match(p.glob, tableName)
+	return matched
+}
+
+func compileTablePatterns(patterns []string) ([]*tablePattern, error) {
+	compiled := make([]*tablePattern, 0, len(patterns))
+	for _, p := range patterns {
+		tp, err := compileTablePattern(p)
+		if err != nil {
+			return nil, err
+		}
+		compiled = append(compiled, tp)
+	}
+	return compiled, nil
+}
+
+func matchAny(patterns []*tablePattern, tableName string) bool {
+	for _, p := range patterns {
+		if p.Match(tableName) {
+			return true
+		}
+	}
+	return false
+}
+
+// FilterTables returns the tables to generate for d: the `tables` list (or every
+// table), narrowed by `include`, minus `exclude` and, with `skip_views`, views
+func (t *migrator) FilterTables(d *properties.Databases) ([]string, error) {
+	include, err := compileTablePatterns(d.Include)
+	if err != nil {
+		return nil, err
+	}
+	exclude, err := compileTablePatterns(d.Exclude)
+	if err != nil {
+		return nil, err
+	}
+
+	tables := d.TableNames()
+	if len(tables) == 0 {
+		tables, err = t.GetTables()
+		if err != nil {
+			return nil, fmt.Errorf("get all tables fail: %w", err)
+		}
+	}
+
+	result := make([]string, 0, len(tables))
+	for _, tableName := range tables {
+		if len(include) > 0 && !matchAny(include, tableName) {
+			continue
+		}
+		if matchAny(exclude, tableName) {
+			continue
+		}
+		if d.SkipViews {
+			tableType, err := t.GetTableType(tableName)
+			if err != nil {
+				return nil, fmt.Errorf("table %s: %w", tableName, err)
+			}
+			if strings.Contains(strings.ToUpper(tableType.Type()), "VIEW") {
+				continue
+			}
+		}
+		result = append(result, tableName)
+	}
+
+	return result, nil
+}
@@ -0,0 +1,89 @@
+package v2
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// ForeignKey is a foreign key constraint of a table, RefColumns is empty when the
+// constraint references the primary key without naming its columns (sqlite)
+type ForeignKey struct {
+	Name       string   `json:"name" yaml:"name"`
+	Columns    []string `json:"columns" yaml:"columns"`
+	RefTable   string   `json:"ref_table" yaml:"ref_table"`
+	RefColumns []string `json:"ref_columns,omitempty" yaml:"ref_columns,omitempty"`
+}
+
+// foreignKeySQL lists the foreign key columns of a table as constraint name, column,
+// referenced table and referenced column, ordered by constraint then position
+var foreignKeySQL = map[string]string{
+	string(dbMySQL): `SELECT CONSTRAINT_NAME, COLUMN_NAME, REFERENCED_TABLE_NAME, REFERENCED_COLUMN_NAME
+		FROM information_schema.KEY_COLUMN_USAGE
+		WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? AND REFERENCED_TABLE_NAME IS NOT NULL
+		ORDER BY CONSTRAINT_NAME, ORDINAL_POSITION`,
+	string(dbPostgres): `SELECT kcu.constraint_name, kcu.column_name, rku.table_name, rku.column_name
+		FROM information_schema.referential_constraints rc
+		JOIN information_schema.key_column_usage kcu
+			ON kcu.constraint_schema = rc.constraint_schema AND kcu.constraint_name = rc.constraint_name
+		JOIN information_schema.key_column_usage rku
+			ON rku.constraint_schema = rc.unique_constraint_schema AND rku.constraint_name = rc.unique_constraint_name
+			AND rku.ordinal_position = kcu.position_in_unique_constraint
+		WHERE kcu.table_schema = CURRENT_SCHEMA() AND kcu.table_name = ?
+		ORDER BY kcu.constraint_name, kcu.ordinal_position`,
+	string(dbSQLServer): `SELECT fk.name, pc.name, OBJECT_NAME(fk.referenced_object_id), rc.name
+		FROM sys.foreign_keys fk
+		JOIN sys.foreign_key_columns fkc ON fkc.constraint_object_id = fk.object_id
+		JOIN sys.columns pc ON pc.object_id = fkc.parent_object_id AND pc.column_id = fkc.parent_column_id
+		JOIN sys.columns rc ON rc.object_id = fkc.referenced_object_id AND rc.column_id = fkc.referenced_column_id
+		WHERE fk.parent_object_id = OBJECT_ID(?)
+		ORDER BY fk.name, fkc.constraint_column_id`,
+	string(dbSQLite): `SELECT id, "from", "table", "to" FROM pragma_foreign_key_list(?) ORDER BY id, seq`,
+}
+
+// GetTableForeignKeys introspects the foreign keys of tableName, a snapshot answers
+// with the foreign keys it was written with
+func (t *migrator) GetTableForeignKeys(tableName string) ([]*ForeignKey, error) {
+	if d, ok := t.Dialector.(*snapshotDialector); ok {
+		for _, table := range d.snapshot.Tables {
+			if table.Name == tableName {
+				return table.ForeignKeys, nil
+			}
+		}
+		return nil, nil
+	}
+
+	query, ok := foreignKeySQL[t.Dialector.Name()]
+	if !ok {
+		return nil, fmt.Errorf("foreign keys of %s are not supported", t.Dialector.Name())
+	}
+
+	rows, err := t.Raw(query, tableName).Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	fks := make([]*ForeignKey, 0)
+	byName := make(map[string]*ForeignKey)
+	for rows.Next() {
+		var (
+			name, column, refTable string
+			refColumn              sql.NullString
+		)
+		if err := rows.Scan(&name, &column, &refTable, &refColumn); err != nil {
+			return nil, err
+		}
+
+		fk, ok := byName[name]
+		if !ok {
+			fk = &ForeignKey{Name: name, RefTable: refTable}
+			byName[name] = fk
+			fks = append(fks, fk)
+		}
+		fk.Columns = append(fk.Columns, column)
+		if refColumn.Valid {
+			fk.RefColumns = append(fk.RefColumns, refColumn.String)
+		}
+	}
+	return fks, rows.Err()
+}
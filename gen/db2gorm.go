@@ -2,6 +2,7 @@ package main
 
 import (
 	"flag"
+	"fmt"
 	"log"
 
 	v2 "github.com/soedomoto/db2gorm"
@@ -9,6 +10,10 @@ import (
 
 func main() {
 	genPath := flag.String("config", "./db2gorm.yml", "is path for db2gorm.yml")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: db2gorm [flags] [generate|snapshot|check|templates export [dir]]\n")
+		flag.PrintDefaults()
+	}
 	flag.Parse()
 	if *genPath != "" {
 		gen, err := v2.NewGeneratorFromFile(*genPath)
@@ -17,7 +22,40 @@ func main() {
 		}
 
 		if gen != nil {
-			gen.Generate()
+			switch cmd := flag.Arg(0); cmd {
+			case "", "generate":
+				if err := gen.Generate(); err != nil {
+					log.Fatalf("generate fail:\n%s", err.Error())
+				}
+			case "snapshot":
+				if err := gen.Snapshot(); err != nil {
+					log.Fatalln(err.Error())
+				}
+			case "check":
+				drifts, err := gen.Check()
+				if err != nil {
+					log.Fatalln(err.Error())
+				}
+				for _, drift := range drifts {
+					fmt.Println(drift)
+				}
+				if len(drifts) > 0 {
+					log.Fatalf("generated code is stale: %d difference(s), run db2gorm generate", len(drifts))
+				}
+			case "templates":
+				if sub := flag.Arg(1); sub != "export" {
+					log.Fatalf("unknown templates command %q (support export for now)", sub)
+				}
+				files, err := gen.ExportTemplates(flag.Arg(2))
+				if err != nil {
+					log.Fatalln(err.Error())
+				}
+				for _, file := range files {
+					fmt.Println(file)
+				}
+			default:
+				log.Fatalf("unknown command %q (support generate || snapshot || check || templates for now)", cmd)
+			}
 			// return
 		}
 	}
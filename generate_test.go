@@ -0,0 +1,106 @@
+package v2
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+func copyFile(t *testing.T, src, dst string) {
+	t.Helper()
+	content, err := os.ReadFile(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(dst, content, 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// fixtureModule generates testdata/fixture into a module of its own, named
+// example.com/fixture and requiring what db2gorm requires, and returns its dir.
+// The fixture *_test.go files are copied next to the generated loaders
+func fixtureModule(t *testing.T) string {
+	t.Helper()
+
+	root, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+
+	gomod, err := os.ReadFile("go.mod")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gomod = regexp.MustCompile(`(?m)^module .*$`).ReplaceAll(gomod, []byte("module example.com/fixture"))
+	if err := os.WriteFile(filepath.Join(dir, "go.mod"), gomod, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	copyFile(t, "go.sum", filepath.Join(dir, "go.sum"))
+	copyFile(t, filepath.Join("testdata", "schema.yml"), filepath.Join(dir, "schema.yml"))
+	copyFile(t, filepath.Join("testdata", "fixture", "db2gorm.yml"), filepath.Join(dir, "db2gorm.yml"))
+	copyFile(t, filepath.Join("testdata", "fixture", "schema.sql"), filepath.Join(dir, "schema.sql"))
+
+	// the configured paths are relative to the working directory
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(root)
+
+	g, err := NewGeneratorFromFile("db2gorm.yml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Generate(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests, err := filepath.Glob(filepath.Join(root, "testdata", "fixture", "*_test.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range tests {
+		copyFile(t, test, filepath.Join(dir, "out", "dataloader", filepath.Base(test)))
+	}
+	return dir
+}
+
+// goCmd runs the go command in the fixture module against a miniredis server
+func goCmd(t *testing.T, dir, redisAddr string, args ...string) []byte {
+	t.Helper()
+
+	cmd := exec.Command("go", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GOFLAGS=-mod=mod", "DB2GORM_FIXTURE_REDIS="+redisAddr)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("go %v: %v\n%s", args, err, out)
+	}
+	return out
+}
+
+// TestGeneratedLoaders renders every template against the fixture schema, builds
+// the output and runs the fixture tests checking the cache hits, misses and
+// negative entries of the primary key, unique, foreign key and composite key
+// loaders and the InvalidatePlugin. The redis benchmarks run a few times too,
+// go test -v shows their roundtrips/op
+func TestGeneratedLoaders(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds the generated code")
+	}
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go command not found")
+	}
+
+	dir := fixtureModule(t)
+	mr := miniredis.RunT(t)
+
+	goCmd(t, dir, mr.Addr(), "vet", "./...")
+	out := goCmd(t, dir, mr.Addr(), "test", "-count=1", "-v", "-bench=.", "-benchtime=20x", "./out/dataloader")
+	t.Logf("%s", out)
+}
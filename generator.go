@@ -1,8 +1,8 @@
 package v2
 
 import (
-	"encoding/json"
 	"fmt"
+	"log"
 	"net/url"
 	"os"
 	"path"
@@ -10,15 +10,19 @@ import (
 	"strings"
 
 	dataloadergen "github.com/soedomoto/db2gorm/module/dataloader"
+	"github.com/soedomoto/db2gorm/module/generror"
+	"github.com/soedomoto/db2gorm/module/schema"
 	"github.com/soedomoto/db2gorm/properties"
 
-	"gopkg.in/yaml.v2"
+	"gopkg.in/yaml.v3"
 	"gorm.io/driver/mysql"
 	"gorm.io/driver/postgres"
 	"gorm.io/driver/sqlite"
 	"gorm.io/driver/sqlserver"
 	"gorm.io/gen"
+	"gorm.io/gen/field"
 	"gorm.io/gorm"
+	gormmigrator "gorm.io/gorm/migrator"
 )
 
 type DBType string
@@ -52,14 +56,56 @@ func ConnectDB(t DBType, dsn string) (*gorm.DB, error) {
 // =================================================================================
 
 func LoadConfigFile(path string) (*properties.YamlProperties, error) {
-	file, err := os.Open(path)
+	content, err := os.ReadFile(path)
 	if err != nil {
 		return nil, err
 	}
-	defer file.Close() // nolint
+
+	var doc yaml.Node
+	if cmdErr := yaml.Unmarshal(content, &doc); cmdErr != nil {
+		return nil, fmt.Errorf("%s: %w", path, cmdErr)
+	}
+	if err := expandEnvNode(&doc); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
 	var props properties.YamlProperties
-	if cmdErr := yaml.NewDecoder(file).Decode(&props); cmdErr != nil {
-		return nil, cmdErr
+	if doc.Kind != 0 {
+		if cmdErr := doc.Decode(&props); cmdErr != nil {
+			return nil, fmt.Errorf("%s: %w", path, cmdErr)
+		}
+	}
+
+	for _, d := range props.Databases {
+		if d.DSNFile != "" && d.DSN != "" {
+			return nil, fmt.Errorf("database %s: dsn and dsn_file cannot be used together", d.Name)
+		}
+		if d.DataloaderUseRedis && !d.DataloaderCache {
+			return nil, fmt.Errorf("database %s: dataloader_use_redis needs dataloader_cache, the loaders ignore their cache otherwise", d.Name)
+		}
+		if d.DSNFile != "" && d.Snapshot == "" {
+			if d.DSN, err = readDSNFile(d.DSNFile); err != nil {
+				return nil, fmt.Errorf("database %s: %w", d.Name, err)
+			}
+		}
+
+		if _, err := GenConfig(d); err != nil {
+			return nil, fmt.Errorf("database %s: %w", d.Name, err)
+		}
+		if err := d.DataloaderOptions.Validate(); err != nil {
+			return nil, fmt.Errorf("database %s: dataloader_options: %w", d.Name, err)
+		}
+		for name, t := range d.DataloaderTables {
+			if t == nil {
+				continue
+			}
+			if err := t.Validate(); err != nil {
+				return nil, fmt.Errorf("database %s: dataloader_tables: %s: %w", d.Name, name, err)
+			}
+		}
+		if _, err := dataloadergen.LoadTemplates(d.TemplatesDir); err != nil {
+			return nil, fmt.Errorf("database %s: %w", d.Name, err)
+		}
 	}
 
 	return &props, nil
@@ -67,6 +113,71 @@ func LoadConfigFile(path string) (*properties.YamlProperties, error) {
 
 // =================================================================================
 
+var genModes = map[string]gen.GenerateMode{
+	"default_query":   gen.WithDefaultQuery,
+	"without_context": gen.WithoutContext,
+	"query_interface": gen.WithQueryInterface,
+}
+
+func boolOr(v *bool, fallback bool) bool {
+	if v == nil {
+		return fallback
+	}
+	return *v
+}
+
+// GenConfig builds the gen.Config of d, keys missing from the yaml keep the values
+// db2gorm always used
+func GenConfig(d *properties.Databases) (gen.Config, error) {
+	c := d.Gen
+
+	mode := gen.WithDefaultQuery | gen.WithoutContext | gen.WithQueryInterface
+	if c.Mode != nil {
+		mode = 0
+		for _, m := range c.Mode {
+			flag, ok := genModes[m]
+			if !ok {
+				return gen.Config{}, fmt.Errorf("unknown gen mode %q (support default_query || without_context || query_interface for now)", m)
+			}
+			mode |= flag
+		}
+	}
+
+	// the dataloader imports the model package next to orm, see ModelPackage
+	if strings.ContainsAny(c.ModelPkgPath, `/\`) {
+		return gen.Config{}, fmt.Errorf("model_pkg_path %q must be a package name, not a path", c.ModelPkgPath)
+	}
+	if strings.ContainsAny(c.OutFile, `/\`) {
+		return gen.Config{}, fmt.Errorf("out_file %q must be a file name, not a path", c.OutFile)
+	}
+
+	return gen.Config{
+		ModelPkgPath: c.ModelPkgPath,
+		OutPath:      filepath.Join(d.OutPath, "orm"),
+		OutFile:      c.OutFile,
+		Mode:         mode,
+
+		WithUnitTest: boolOr(c.WithUnitTest, false),
+
+		FieldNullable:     boolOr(c.FieldNullable, true),
+		FieldCoverable:    boolOr(c.FieldCoverable, false),
+		FieldWithIndexTag: boolOr(c.FieldWithIndexTag, true),
+		FieldWithTypeTag:  boolOr(c.FieldWithTypeTag, true),
+		FieldSignable:     boolOr(c.FieldSignable, false),
+	}, nil
+}
+
+// inParamLimit is the number of keys one IN query may bind, sqlserver refuses more
+// than 2100 parameters and sqlite builds without SQLITE_MAX_VARIABLE_NUMBER stop at 999
+var inParamLimit = map[DBType]int{
+	dbMySQL:     65535,
+	dbPostgres:  65535,
+	dbSQLite:    999,
+	dbSQLServer: 2000,
+}
+
+// =================================================================================
+
 type migrator struct{ *gorm.DB }
 type Table struct {
 	gorm.TableType
@@ -86,9 +197,30 @@ func (t *migrator) GetTables() (result []string, err error) {
 	return tableList, nil
 }
 
+// tableTypeSQL reads the table type for the dialects whose gorm driver does not
+// implement TableType yet
+var tableTypeSQL = map[string]string{
+	string(dbPostgres):  "SELECT table_schema, table_name, table_type FROM information_schema.tables WHERE table_schema = CURRENT_SCHEMA() AND table_name = ?",
+	string(dbSQLServer): "SELECT TABLE_SCHEMA, TABLE_NAME, TABLE_TYPE FROM INFORMATION_SCHEMA.TABLES WHERE TABLE_CATALOG = DB_NAME() AND TABLE_NAME = ?",
+	string(dbSQLite):    "SELECT 'main', name, UPPER(type) FROM sqlite_master WHERE name = ?",
+}
+
 func (t *migrator) GetTableType(tableName string) (tableType gorm.TableType, err error) {
 	tableType, err = t.Migrator().TableType(tableName)
-	return tableType, err
+	if err == nil {
+		return tableType, nil
+	}
+
+	query, ok := tableTypeSQL[t.Dialector.Name()]
+	if !ok {
+		return nil, err
+	}
+
+	var table gormmigrator.TableType
+	if scanErr := t.Raw(query, tableName).Row().Scan(&table.SchemaValue, &table.NameValue, &table.TypeValue); scanErr != nil {
+		return nil, scanErr
+	}
+	return table, nil
 }
 
 func (t *migrator) GetTableColumns(tableName string) (result []*Column, err error) {
@@ -112,14 +244,32 @@ type generator struct {
 	config *properties.YamlProperties
 }
 
+func connectDSN(dsn string) (*gorm.DB, error) {
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	return ConnectDB(DBType(u.Scheme), dsn)
+}
+
 func (g *generator) ConnectDb() error {
 	for _, d := range g.config.Databases {
-		u, err := url.Parse(d.DSN)
-		if err != nil {
-			return err
+		if d.Snapshot != "" {
+			db, err := OpenSnapshot(d.Snapshot)
+			if err != nil {
+				return err
+			}
+
+			d.Db = db
+			continue
 		}
 
-		db, err := ConnectDB(DBType(u.Scheme), d.DSN)
+		dsn, err := databaseDSN(d)
+		if err != nil {
+			return fmt.Errorf("database %s: %w", d.Name, err)
+		}
+		db, err := connectDSN(dsn)
 		if err != nil {
 			return err
 		}
@@ -130,83 +280,387 @@ func (g *generator) ConnectDb() error {
 	return nil
 }
 
-func (g *generator) GenerateModel(d *properties.Databases) []interface{} {
-	ggen := gen.NewGenerator(gen.Config{
-		ModelPkgPath: "",
-		OutPath:      filepath.Join(d.OutPath, "orm"),
-		Mode:         gen.WithDefaultQuery | gen.WithoutContext | gen.WithQueryInterface,
+// catch turns a gen panic into an error, gen reports most failures by panicking
+func catch(fn func()) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+
+	fn()
+	return nil
+}
 
-		WithUnitTest: false,
+// genModel is a gen model, model is what ApplyBasic takes and relate builds the
+// relation fields pointing to it
+type genModel struct {
+	model  interface{}
+	table  func() *schema.Table
+	relate func(field.RelationshipType, string, *field.RelateConfig) gen.ModelOpt
+}
+
+// generateModel runs gen on table t, table reads its model field by field so a
+// change in gen breaks the build here instead of silently emptying the tables.
+// The field names are final once the model went through ApplyBasic, which
+// escapes the names of the query methods
+func generateModel(ggen *gen.Generator, t, modelName string, opts ...gen.ModelOpt) (*genModel, error) {
+	var m *genModel
+	err := catch(func() {
+		meta := ggen.GenerateModelAs(t, modelName, opts...)
+		if meta == nil {
+			return
+		}
 
-		FieldNullable:     true,
-		FieldCoverable:    false,
-		FieldWithIndexTag: true,
-		FieldWithTypeTag:  true,
-		FieldSignable:     false,
+		m = &genModel{model: meta}
+		m.table = func() *schema.Table {
+			table := &schema.Table{Name: meta.TableName, ModelStructName: meta.ModelStructName}
+			for _, f := range meta.Fields {
+				table.Fields = append(table.Fields, &schema.Field{
+					Name:          f.Name,
+					Type:          f.Type,
+					ColumnName:    f.ColumnName,
+					ColumnComment: f.ColumnComment,
+					Tag:           f.Tag,
+					GORMTag:       f.GORMTag,
+					Relation:      f.Relation,
+				})
+			}
+			return table
+		}
+		m.relate = func(rt field.RelationshipType, name string, config *field.RelateConfig) gen.ModelOpt {
+			return gen.FieldRelate(rt, name, meta, config)
+		}
 	})
+	if err != nil || m == nil {
+		return nil, err
+	}
+	if len(m.table().Fields) == 0 {
+		return nil, fmt.Errorf("gen model %s has no field", modelName)
+	}
+	return m, nil
+}
+
+// relateOpts returns the relation fields of s by table, pointing to the models
+func relateOpts(s *schema.Schema, models map[string]*genModel) map[string][]gen.ModelOpt {
+	opts := make(map[string][]gen.ModelOpt)
+	for _, r := range s.Relations {
+		target, ok := models[r.Target]
+		if !ok {
+			continue
+		}
+		opts[r.Table] = append(opts[r.Table], target.relate(r.Type, r.Name, &field.RelateConfig{
+			RelatePointer:      r.Type != field.HasMany,
+			RelateSlicePointer: r.Type == field.HasMany,
+			GORMTag:            r.GORMTag(),
+		}))
+	}
+	return opts
+}
+
+// BuildSchema introspects the tables of d into the schema both the model and the
+// dataloader code are generated from, gen only maps the columns to fields here
+func (g *generator) BuildSchema(d *properties.Databases) (*schema.Schema, error) {
+	genConfig, err := GenConfig(d)
+	if err != nil {
+		return nil, err
+	}
+	ggen := gen.NewGenerator(genConfig)
+
+	ggen.UseDB(d.Db)
+
+	s := &schema.Schema{}
+	errs := generror.List{}
+
+	m := &migrator{d.Db}
+	tables, err := m.FilterTables(d)
+	if err != nil {
+		return nil, err
+	}
+
+	models := make(map[string]*genModel)
+	for _, t := range tables {
+		gm, err := generateModel(ggen, t, d.Db.NamingStrategy.SchemaName(t))
+		errs.Add("", t, "", err)
+		if gm == nil {
+			continue
+		}
+		errs.Add("", t, "", catch(func() { ggen.ApplyBasic(gm.model) }))
+		table := gm.table()
+
+		// gen ignores index errors as well, the field tags are used instead
+		indexes, _ := m.GetTableIndex(t)
+		for _, idx := range indexes {
+			pk, _ := idx.PrimaryKey()
+			unique, _ := idx.Unique()
+			table.Indexes = append(table.Indexes, schema.Index{
+				Name:       idx.Name(),
+				Columns:    idx.Columns(),
+				PrimaryKey: pk,
+				Unique:     unique,
+			})
+		}
+
+		fks, err := m.GetTableForeignKeys(t)
+		if err != nil {
+			log.Printf("foreign keys of %s: %s", t, err)
+		}
+		for _, fk := range fks {
+			table.ForeignKeys = append(table.ForeignKeys, schema.ForeignKey{
+				Name:       fk.Name,
+				Columns:    fk.Columns,
+				RefTable:   fk.RefTable,
+				RefColumns: fk.RefColumns,
+			})
+		}
+
+		models[t] = gm
+		s.Tables = append(s.Tables, table)
+	}
+
+	if boolOr(d.Gen.WithRelations, true) {
+		s.Relations = Relations(d, s)
+
+		// the relation fields point to the models of the first pass, gen cannot
+		// build two models referencing each other in one go
+		opts := relateOpts(s, models)
+		for _, t := range s.Tables {
+			if len(opts[t.Name]) == 0 {
+				continue
+			}
+			gm, err := generateModel(ggen, t.Name, t.ModelStructName, opts[t.Name]...)
+			errs.Add("", t.Name, "", err)
+			if gm == nil {
+				continue
+			}
+			errs.Add("", t.Name, "", catch(func() { ggen.ApplyBasic(gm.model) }))
+			t.Fields = gm.table().Fields
+		}
+	}
+
+	return s, errs.Err()
+}
+
+// fieldOpts makes gen give the column fields of t the types, tags and comments of t
+func fieldOpts(t *schema.Table) []gen.ModelOpt {
+	opts := make([]gen.ModelOpt, 0, len(t.Fields)*4)
+	for _, f := range t.Fields {
+		if f.Relation != nil || f.ColumnName == "" {
+			continue
+		}
+
+		f := f
+		opts = append(opts,
+			gen.FieldType(f.ColumnName, f.Type),
+			gen.FieldComment(f.ColumnName, f.ColumnComment),
+			gen.FieldTag(f.ColumnName, func(field.Tag) field.Tag {
+				tag := field.Tag{}
+				for k, v := range f.Tag {
+					tag.Set(k, v)
+				}
+				return tag
+			}),
+			gen.FieldGORMTag(f.ColumnName, func(field.GormTag) field.GormTag {
+				tag := field.GormTag{}
+				for k, v := range f.GORMTag {
+					tag.Set(k, v)
+				}
+				return tag
+			}),
+		)
+	}
+	return opts
+}
+
+// diffFields returns the first difference between the fields of the schema table
+// want and the gen model got
+func diffFields(want, got *schema.Table) error {
+	if want.ModelStructName != got.ModelStructName {
+		return fmt.Errorf("gen model %s, schema has %s", got.ModelStructName, want.ModelStructName)
+	}
+	if len(want.Fields) != len(got.Fields) {
+		return fmt.Errorf("gen model %s has %d fields, schema has %d", got.ModelStructName, len(got.Fields), len(want.Fields))
+	}
+	for i, w := range want.Fields {
+		f := got.Fields[i]
+		if f.Name != w.Name || f.Type != w.Type || f.ColumnName != w.ColumnName ||
+			f.Tag.Build() != w.Tag.Build() || f.GORMTag.Build() != w.GORMTag.Build() || (f.Relation == nil) != (w.Relation == nil) {
+			return fmt.Errorf("gen field %s.%s %s does not match the schema field %s %s", got.ModelStructName, f.Name, f.Type, w.Name, w.Type)
+		}
+	}
+	return nil
+}
+
+// GenerateModel generates the gen models and query code of the tables of s. gen
+// is given the fields of s and a model differing from them is an error, so the
+// models and the dataloader always agree
+func (g *generator) GenerateModel(d *properties.Databases, s *schema.Schema) error {
+	genConfig, err := GenConfig(d)
+	if err != nil {
+		return err
+	}
+	ggen := gen.NewGenerator(genConfig)
 
 	ggen.UseDB(d.Db)
 
-	tableModels := make([]interface{}, 0)
+	errs := generror.List{}
+	models := make(map[string]*genModel, len(s.Tables))
+	for _, t := range s.Tables {
+		gm, err := generateModel(ggen, t.Name, t.ModelStructName, fieldOpts(t)...)
+		errs.Add("", t.Name, "", err)
+		if gm != nil {
+			models[t.Name] = gm
+		}
+	}
 
-	strTables := strings.Trim(d.StrTables, " ")
-	if strTables == "" {
-		tableModels = ggen.GenerateAllTable()
-	} else {
-		for _, t := range strings.Split(strTables, ",") {
-			tableModels = append(tableModels, ggen.GenerateModel(strings.Trim(t, " ")))
+	opts := relateOpts(s, models)
+	for _, t := range s.Tables {
+		if len(opts[t.Name]) == 0 {
+			continue
+		}
+		gm, err := generateModel(ggen, t.Name, t.ModelStructName, append(fieldOpts(t), opts[t.Name]...)...)
+		errs.Add("", t.Name, "", err)
+		if gm != nil {
+			models[t.Name] = gm
 		}
 	}
 
-	if tableModels != nil {
-		ggen.ApplyBasic(tableModels...)
-		ggen.Execute()
+	tableModels := make([]interface{}, 0, len(models))
+	for _, t := range s.Tables {
+		if gm, ok := models[t.Name]; ok {
+			tableModels = append(tableModels, gm.model)
+		}
+	}
+	if len(tableModels) == 0 {
+		return errs.Err()
+	}
+	errs.Add("", "", "", catch(func() { ggen.ApplyBasic(tableModels...) }))
+
+	// nothing is written when a model differs from the schema
+	mismatch := false
+	for _, t := range s.Tables {
+		gm, ok := models[t.Name]
+		if !ok {
+			continue
+		}
+		if err := diffFields(t, gm.table()); err != nil {
+			errs.Add("", t.Name, "", err)
+			mismatch = true
+		}
+	}
+	if !mismatch {
+		errs.Add("", "", "", catch(ggen.Execute))
 	}
 
-	return tableModels
+	return errs.Err()
 }
 
-func (g *generator) GenerateDataloader(d *properties.Databases, tableList []interface{}) error {
+func (g *generator) GenerateDataloader(d *properties.Databases, s *schema.Schema) error {
+	templates, err := dataloadergen.LoadTemplates(d.TemplatesDir)
+	if err != nil {
+		return err
+	}
+
 	ggen := dataloadergen.NewGenerator(dataloadergen.Config{
 		OutPath:      filepath.Join(d.OutPath, "dataloader"),
 		Package:      "dataloader",
-		ModelPackage: path.Join(d.ModuleName, d.OutPath, "model"),
+		ModelPackage: path.Join(d.ModuleName, d.OutPath, d.Gen.ModelPkg()),
 		OrmPackage:   path.Join(d.ModuleName, d.OutPath, "orm"),
+		MaxParams:    inParamLimit[DBType(d.Db.Dialector.Name())],
+		Templates:    templates,
 	})
 
 	StructFields := make([][]string, 0)
-	for _, t := range tableList {
-		if t != nil {
-		}
-
-		model := &dataloadergen.Model{}
-		byteData, _ := json.Marshal(t)
-		json.Unmarshal(byteData, &model)
-
-		SFs := ggen.GenerateDataloader(d, *model)
+	errs := generror.List{}
+	for _, t := range s.Tables {
+		SFs, err := ggen.GenerateDataloader(d, t)
+		errs.Add("", t.Name, "", err)
 		StructFields = append(StructFields, SFs...)
 	}
 
-	ggen.GenerateDataloaderAgg(StructFields)
+	errs.Add("", "", "", ggen.GenerateRelations(d, s.Relations))
+	errs.Add("", "", "", ggen.GenerateInvalidate(d))
+	errs.Add("", "", "", ggen.GenerateDataloaderAgg(d, StructFields))
 
-	return nil
+	return errs.Err()
+}
+
+// ExportTemplates writes the default dataloader templates to dir as a starting
+// point for templates_dir, blank dir means the first templates_dir configured
+// or "templates". Existing files are kept
+func (g *generator) ExportTemplates(dir string) ([]string, error) {
+	for _, d := range g.config.Databases {
+		if dir == "" {
+			dir = d.TemplatesDir
+		}
+	}
+	if dir == "" {
+		dir = "templates"
+	}
+	return dataloadergen.ExportTemplates(dir)
 }
 
+// Generate generates every database and reports all failures as a generror.List
 func (g *generator) Generate() error {
 	err := g.ConnectDb()
 	if err != nil {
 		return err
 	}
 
+	errs := generror.List{}
 	for _, d := range g.config.Databases {
-		tableList := g.GenerateModel(d)
-		if tableList != nil && d.Dataloader {
-			g.GenerateDataloader(d, tableList)
+		s, err := g.BuildSchema(d)
+		errs.Add(d.Name, "", "", err)
+		if s == nil || len(s.Tables) == 0 {
+			continue
+		}
+
+		errs.Add(d.Name, "", "", g.GenerateModel(d, s))
+		if d.Dataloader {
+			errs.Add(d.Name, "", "", g.GenerateDataloader(d, s))
 		}
 	}
 
 	// tools.Tidy()
 
+	return errs.Err()
+}
+
+// Snapshot dumps the schema of every database to its snapshot file, it always
+// reads from the live database
+func (g *generator) Snapshot() error {
+	for _, d := range g.config.Databases {
+		dsn, err := databaseDSN(d)
+		if err != nil {
+			return fmt.Errorf("database %s: %w", d.Name, err)
+		}
+		db, err := connectDSN(dsn)
+		if err != nil {
+			return err
+		}
+
+		m := &migrator{db}
+		tables, err := m.FilterTables(d)
+		if err != nil {
+			return fmt.Errorf("snapshot %s: %w", d.Name, err)
+		}
+
+		s, err := m.Snapshot(tables)
+		if err != nil {
+			return fmt.Errorf("snapshot %s: %w", d.Name, err)
+		}
+
+		snapshotPath := d.Snapshot
+		if snapshotPath == "" {
+			snapshotPath = filepath.Join(d.OutPath, "schema.yml")
+		}
+
+		if err := WriteSnapshotFile(snapshotPath, s); err != nil {
+			return err
+		}
+		log.Printf("snapshot of %s written to %s (%d tables)", d.Name, snapshotPath, len(s.Tables))
+	}
+
 	return nil
 }
 
@@ -2,20 +2,26 @@ package dataloader
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
-	"html/template"
 	"io"
 	"io/ioutil"
 	"os"
+	"path"
+	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
+	"text/template"
+	"time"
 
-	tpl "github.com/soedomoto/db2gorm/module/dataloader/template"
+	"github.com/soedomoto/db2gorm/module/generror"
+	"github.com/soedomoto/db2gorm/module/schema"
 	"github.com/soedomoto/db2gorm/properties"
 
 	dataloadgen "github.com/vektah/dataloaden/pkg/generator"
 	"golang.org/x/tools/imports"
-	"gorm.io/gen/field"
 )
 
 func IsDirEmpty(name string) (bool, error) {
@@ -36,20 +42,38 @@ func join(sep string, s []string) string {
 	return strings.Join(s, sep)
 }
 
-func render(tmpl string, wr io.Writer, data interface{}) error {
-	t, err := template.New(tmpl).Funcs(template.FuncMap{
-		"join": join,
-		"getField": func(byref bool, field string) string {
-			if byref {
-				return "*" + field
-			}
-			return field
-		},
-	}).Parse(tmpl)
-	if err != nil {
-		return err
+// durationLiteral writes d as Go source, e.g. 2 * time.Millisecond
+func durationLiteral(d time.Duration) string {
+	if d == 0 {
+		return "0"
 	}
-	return t.Execute(wr, data)
+	for _, unit := range []struct {
+		d    time.Duration
+		name string
+	}{
+		{time.Hour, "time.Hour"},
+		{time.Minute, "time.Minute"},
+		{time.Second, "time.Second"},
+		{time.Millisecond, "time.Millisecond"},
+		{time.Microsecond, "time.Microsecond"},
+	} {
+		if d != 0 && d%unit.d == 0 {
+			return fmt.Sprintf("%d * %s", d/unit.d, unit.name)
+		}
+	}
+	return fmt.Sprintf("%d * time.Nanosecond", d)
+}
+
+// funcMap is shared by every template
+var funcMap = template.FuncMap{
+	"join":     join,
+	"duration": durationLiteral,
+	"getField": func(byref bool, field string) string {
+		if byref {
+			return "*" + field
+		}
+		return field
+	},
 }
 
 func output(fileName string, content []byte) error {
@@ -74,7 +98,10 @@ func output(fileName string, content []byte) error {
 }
 
 func NewGenerator(config Config) *Generator {
-	return &Generator{config}
+	if config.Templates == nil {
+		config.Templates, _ = LoadTemplates("")
+	}
+	return &Generator{config: config, models: map[string]*schema.Table{}, loaders: map[string]*loader{}}
 }
 
 type Config struct {
@@ -82,149 +109,344 @@ type Config struct {
 	Package      string
 	ModelPackage string
 	OrmPackage   string
+	MaxParams    int        // keys one IN query may bind, 0 = no limit
+	Templates    *Templates // see LoadTemplates, nil means the defaults
 }
 
-type Model struct {
-	Generated       bool   // whether to generate db model
-	FileName        string // generated file name
-	S               string // the first letter(lower case)of simple Name (receiver)
-	QueryStructName string // internal query struct name
-	ModelStructName string // origin/model struct name
-	TableName       string // table name in db server
-	// StructInfo      parser.Param
-	Fields []*Field
-	// Source          model.SourceCode
-	ImportPkgPaths []string
-	// ModelMethods    []*parser.Method // user custom method bind to db base struct
+type Generator struct {
+	config  Config
+	models  map[string]*schema.Table // by table name
+	loaders map[string]*loader       // by loader variable name, e.g. Datapokok_ID
 }
 
-type Field struct {
-	Name             string
-	Type             string
-	ColumnName       string
-	ColumnComment    string
-	MultilineComment bool
-	Tag              field.Tag
-	GORMTag          field.GormTag
-	CustomGenType    string
-	Relation         *field.Relation
+// loader is a generated loader, Single ones return one record per key
+type loader struct {
+	Model     string // the model struct name
+	FieldName string
+	Single    bool
+	KeyType   string // the key struct of composite keys
+	KeyFields []*schema.Field
 }
 
-type Generator struct {
-	config Config
+// dataloaden generates the loader types without dataloader_context, it loads the
+// model package so the golden tests replace it
+var dataloaden = dataloadgen.Generate
+
+// generateLoader writes the loader type of name, a dataloaden loader or, with
+// dataloader_context, the context-aware LoaderCtx
+func (g *Generator) generateLoader(d *properties.Databases, name, keyType, valueModifier, modelStructName string) error {
+	if !d.DataloaderContext {
+		if err := dataloaden(name, keyType, valueModifier+g.config.ModelPackage+"."+modelStructName, g.config.OutPath); err != nil {
+			return fmt.Errorf("dataloaden: %w", err)
+		}
+		return nil
+	}
+
+	var loaderBuf bytes.Buffer
+	if err := g.config.Templates.render("Header", &loaderBuf, map[string]interface{}{
+		"Package":        g.config.Package,
+		"ImportPkgPaths": []string{g.config.ModelPackage},
+	}); err != nil {
+		return err
+	}
+	if err := g.config.Templates.render("LoaderCtx", &loaderBuf, map[string]interface{}{
+		"Name":     name,
+		"LcName":   strings.ToLower(name[:1]) + name[1:],
+		"Model":    modelStructName,
+		"Field":    strings.TrimSuffix(strings.TrimPrefix(name, modelStructName+"_"), "Loader"),
+		"KeyType":  keyType,
+		"ValType":  valueModifier + path.Base(g.config.ModelPackage) + "." + modelStructName,
+		"ValIsPtr": valueModifier == "*",
+	}); err != nil {
+		return err
+	}
+
+	return output(filepath.Join(g.config.OutPath, strings.ToLower(name)+"_gen.go"), loaderBuf.Bytes())
 }
 
-func (g *Generator) GenerateDataloader(d *properties.Databases, m Model) [][]string {
+func (g *Generator) GenerateDataloader(d *properties.Databases, m *schema.Table) ([][]string, error) {
 	StructFields := make([][]string, 0)
+	errs := generror.List{}
 
-	os.MkdirAll(g.config.OutPath, os.ModePerm)
+	if err := os.MkdirAll(g.config.OutPath, os.ModePerm); err != nil {
+		return StructFields, err
+	}
 	empty, err := IsDirEmpty(g.config.OutPath)
 	if err == nil && empty {
-		output(fmt.Sprintf("%s/package.go", g.config.OutPath), []byte(`package dataloader`))
+		err = output(fmt.Sprintf("%s/package.go", g.config.OutPath), []byte(`package dataloader`))
+	}
+	if err != nil {
+		return StructFields, err
 	}
 
 	dataloaderBytes := make([]byte, 0)
-	importPkgPaths := []string{"github.com/redis/go-redis/v9", g.config.ModelPackage, g.config.OrmPackage}
+	importPkgPaths := []string{g.config.ModelPackage, g.config.OrmPackage, "gorm.io/gen/field"}
 
 	var dataloaderBuf bytes.Buffer
-	renderErr := render(tpl.Header, &dataloaderBuf, map[string]interface{}{
+	renderErr := g.config.Templates.render("Header", &dataloaderBuf, map[string]interface{}{
 		"Package":        g.config.Package,
 		"ImportPkgPaths": importPkgPaths,
 	})
+	if renderErr != nil {
+		return StructFields, renderErr
+	}
+	dataloaderBytes = append(dataloaderBytes, dataloaderBuf.Bytes()...)
 
-	if renderErr == nil {
-		dataloaderBytes = append(dataloaderBytes, dataloaderBuf.Bytes()...)
+	options := d.DataloaderOptionsOf(m.Name)
+	chunkSize := options.ChunkSize
+	if g.config.MaxParams > 0 && (chunkSize <= 0 || chunkSize > g.config.MaxParams) {
+		chunkSize = g.config.MaxParams
+	}
+
+	keys := modelKeys(m)
+	var pk *Key
+	if len(keys) > 0 && keys[0].Primary {
+		pk = &keys[0]
+	}
+
+	fields := d.DataloaderFieldsOf(m.Name)
+	isForeignKey := make(map[string]bool)
+	for _, fk := range m.ForeignKeys {
+		for _, c := range fk.Columns {
+			isForeignKey[c] = true
+		}
 	}
 
 	for _, f := range m.Fields {
+		// relation fields are loaded through their foreign key columns
+		if f.Relation != nil {
+			continue
+		}
+
 		Fieldname := f.Name
 		Fieldtype := strings.ReplaceAll(f.Type, "*", "")
 		Asterisk := ""
 		if strings.Contains(f.Type, "*") {
 			Asterisk = "*"
 		}
-		IsPk := strings.Contains(f.GORMTag.Build(), "primaryKey")
+		// a column of a composite primary key is loaded like any other column
+		IsPk := pk.Has(f)
+		IsUnique := false
+		for i := range keys {
+			IsUnique = IsUnique || keys[i].Has(f)
+		}
 
 		if d.DataloaderPkOnly && !IsPk {
 			continue
 		}
+		if !fields.Selects(f.ColumnName, IsPk || IsUnique || isForeignKey[f.ColumnName]) {
+			continue
+		}
 
-		err := fmt.Errorf("")
-		if IsPk {
-			err = dataloadgen.Generate(m.ModelStructName+"_"+Fieldname+"Loader", Fieldtype, "*"+g.config.ModelPackage+"."+m.ModelStructName, g.config.OutPath)
-		} else {
-			err = dataloadgen.Generate(m.ModelStructName+"_"+Fieldname+"Loader", Fieldtype, "[]*"+g.config.ModelPackage+"."+m.ModelStructName, g.config.OutPath)
+		valueModifier := "[]*"
+		if IsUnique {
+			valueModifier = "*"
 		}
 
-		if err != nil {
+		if err := g.generateLoader(d, m.ModelStructName+"_"+Fieldname+"Loader", Fieldtype, valueModifier, m.ModelStructName); err != nil {
+			errs.Add(d.Name, m.Name, Fieldname, err)
 			continue
 		}
 
-		template := tpl.DataloaderNpk
-		if IsPk {
-			template = tpl.DataloaderPk
+		template := "DataloaderNpk"
+		if IsUnique {
+			template = "DataloaderPk"
 		}
 
 		var dataloaderBuf bytes.Buffer
-		renderErr := render(template, &dataloaderBuf, map[string]interface{}{
-			"Package":         g.config.Package,
-			"ImportPkgPaths":  importPkgPaths,
-			"ModelStructName": m.ModelStructName,
-			"FieldName":       Fieldname,
-			"Fieldtype":       Fieldtype,
-			"Asterisk":        Asterisk,
-			"IsPk":            IsPk,
-			"UseRedis":        d.DataloaderUseRedis,
+		renderErr := g.config.Templates.render(template, &dataloaderBuf, map[string]interface{}{
+			"Package":          g.config.Package,
+			"ImportPkgPaths":   importPkgPaths,
+			"ModelPkg":         path.Base(g.config.ModelPackage),
+			"ModelStructName":  m.ModelStructName,
+			"FieldName":        Fieldname,
+			"Fieldtype":        Fieldtype,
+			"Asterisk":         Asterisk,
+			"IsPk":             IsPk,
+			"IsUnique":         IsUnique,
+			"UseCache":         d.DataloaderCache,
+			"UseContext":       d.DataloaderContext,
+			"Wait":             options.Wait,
+			"MaxBatch":         options.MaxBatch,
+			"CacheTTL":         options.CacheTTL,
+			"ChunkSize":        chunkSize,
+			"Concurrency":      options.Concurrency,
+			"NegativeCacheTTL": options.NegativeCacheTTL,
+			"NotFoundError":    d.DataloaderNotFoundError,
+			"KeyParams":        1,
 		})
 
-		if renderErr == nil {
-			dataloaderBytes = append(dataloaderBytes, dataloaderBuf.Bytes()...)
-			StructFields = append(StructFields, []string{m.ModelStructName, Fieldname})
+		if renderErr != nil {
+			errs.Add(d.Name, m.Name, Fieldname, fmt.Errorf("render: %w", renderErr))
+			continue
 		}
+
+		dataloaderBytes = append(dataloaderBytes, dataloaderBuf.Bytes()...)
+		StructFields = append(StructFields, []string{m.ModelStructName, Fieldname})
+		g.loaders[m.ModelStructName+"_"+Fieldname] = &loader{Model: m.ModelStructName, FieldName: Fieldname, Single: IsUnique, KeyFields: []*schema.Field{f}}
 	}
 
-	outputErr := output(fmt.Sprintf("%s/%s.gen.go", g.config.OutPath, m.TableName), dataloaderBytes)
-	if outputErr == nil {
-		return StructFields
+	for _, k := range keys {
+		if len(k.Fields) < 2 || (d.DataloaderPkOnly && !k.Primary) {
+			continue
+		}
+		selected := true
+		for _, f := range k.Fields {
+			selected = selected && fields.Selects(f.ColumnName, true)
+		}
+		if !selected {
+			continue
+		}
+
+		Fieldname := k.FieldName()
+		keyType := m.ModelStructName + "_" + Fieldname + "Key"
+		keyFields := make([]map[string]string, 0, len(k.Fields))
+		for _, f := range k.Fields {
+			Asterisk := ""
+			if strings.Contains(f.Type, "*") {
+				Asterisk = "*"
+			}
+			keyFields = append(keyFields, map[string]string{
+				"Name":     f.Name,
+				"Type":     strings.ReplaceAll(f.Type, "*", ""),
+				"Asterisk": Asterisk,
+			})
+		}
+
+		if err := g.generateLoader(d, m.ModelStructName+"_"+Fieldname+"Loader", keyType, "*", m.ModelStructName); err != nil {
+			errs.Add(d.Name, m.Name, Fieldname, err)
+			continue
+		}
+
+		var dataloaderBuf bytes.Buffer
+		renderErr := g.config.Templates.render("DataloaderComposite", &dataloaderBuf, map[string]interface{}{
+			"ModelPkg":         path.Base(g.config.ModelPackage),
+			"ModelStructName":  m.ModelStructName,
+			"FieldName":        Fieldname,
+			"IndexName":        k.Name,
+			"KeyType":          keyType,
+			"KeyFields":        keyFields,
+			"UseCache":         d.DataloaderCache,
+			"UseContext":       d.DataloaderContext,
+			"Wait":             options.Wait,
+			"MaxBatch":         options.MaxBatch,
+			"CacheTTL":         options.CacheTTL,
+			"ChunkSize":        chunkSize,
+			"Concurrency":      options.Concurrency,
+			"NegativeCacheTTL": options.NegativeCacheTTL,
+			"NotFoundError":    d.DataloaderNotFoundError,
+			"KeyParams":        len(k.Fields),
+		})
+		if renderErr != nil {
+			errs.Add(d.Name, m.Name, Fieldname, fmt.Errorf("render: %w", renderErr))
+			continue
+		}
+
+		dataloaderBytes = append(dataloaderBytes, dataloaderBuf.Bytes()...)
+		StructFields = append(StructFields, []string{m.ModelStructName, Fieldname})
+		g.loaders[m.ModelStructName+"_"+Fieldname] = &loader{Model: m.ModelStructName, FieldName: Fieldname, Single: true, KeyType: keyType, KeyFields: k.Fields}
 	}
 
-	return make([][]string, 0)
+	g.models[m.Name] = m
+
+	outputErr := output(fmt.Sprintf("%s/%s.gen.go", g.config.OutPath, m.Name), dataloaderBytes)
+	if outputErr != nil {
+		errs.Add(d.Name, m.Name, "", outputErr)
+		return make([][]string, 0), errs.Err()
+	}
+
+	return StructFields, errs.Err()
 }
 
-func (g *Generator) GenerateDataloaderAgg(StructFields [][]string) {
+// GenerateCache writes the Cache interface and its adapters, the redis adapter only
+// with dataloader_use_redis
+func (g *Generator) GenerateCache(d *properties.Databases) error {
+	importPkgPaths := []string{}
+	if d.DataloaderUseRedis {
+		importPkgPaths = append(importPkgPaths, "github.com/redis/go-redis/v9")
+	}
+
+	var cacheBuf bytes.Buffer
+	if err := g.config.Templates.render("Header", &cacheBuf, map[string]interface{}{
+		"Package":        g.config.Package,
+		"ImportPkgPaths": importPkgPaths,
+	}); err != nil {
+		return err
+	}
+	if err := g.config.Templates.render("Cache", &cacheBuf, map[string]interface{}{
+		"UseRedis": d.DataloaderUseRedis,
+	}); err != nil {
+		return err
+	}
+
+	return output(filepath.Join(g.config.OutPath, "cache.gen.go"), cacheBuf.Bytes())
+}
+
+// cacheVersion hashes what the cached JSON payload of m depends on, the name,
+// type and json tag of every field
+func cacheVersion(m *schema.Table) string {
+	h := sha256.New()
+	fmt.Fprintln(h, m.ModelStructName)
+	for _, f := range m.Fields {
+		fmt.Fprintln(h, f.Name, f.Type, f.Tag["json"])
+	}
+	return hex.EncodeToString(h.Sum(nil))[:8]
+}
+
+func (g *Generator) GenerateDataloaderAgg(d *properties.Databases, StructFields [][]string) error {
+	if err := g.GenerateCache(d); err != nil {
+		return err
+	}
+
 	dataloaderBytes := make([]byte, 0)
 
 	var dataloaderHeaderBuf bytes.Buffer
-	renderErr := render(tpl.Header, &dataloaderHeaderBuf, map[string]interface{}{
+	renderErr := g.config.Templates.render("Header", &dataloaderHeaderBuf, map[string]interface{}{
 		"Package":        g.config.Package,
-		"ImportPkgPaths": []string{"github.com/redis/go-redis/v9", g.config.ModelPackage, g.config.OrmPackage},
+		"ImportPkgPaths": []string{g.config.ModelPackage, g.config.OrmPackage},
 	})
-
-	if renderErr == nil {
-		dataloaderBytes = append(dataloaderBytes, dataloaderHeaderBuf.Bytes()...)
+	if renderErr != nil {
+		return renderErr
 	}
+	dataloaderBytes = append(dataloaderBytes, dataloaderHeaderBuf.Bytes()...)
 
 	Fields := make([]string, 0)
 	Inits := make([]string, 0)
 	for _, sf := range StructFields {
 		Fields = append(Fields, fmt.Sprintf("%s_%s *%s_%sLoader", sf[0], sf[1], sf[0], sf[1]))
-		Inits = append(Inits, fmt.Sprintf("%s_%s= Get%s_%sLoader(Q, redisClient)", sf[0], sf[1], sf[0], sf[1]))
+		Inits = append(Inits, fmt.Sprintf("%s_%s= Get%s_%sLoader(Q, cache, opts...)", sf[0], sf[1], sf[0], sf[1]))
+	}
+
+	prefix := d.Name + ":"
+	if d.DataloaderCachePrefix != "" {
+		prefix = d.DataloaderCachePrefix + ":" + prefix
+	}
+
+	tableNames := make([]string, 0, len(g.models))
+	for name := range g.models {
+		tableNames = append(tableNames, name)
+	}
+	sort.Strings(tableNames)
+	versions := make([][]string, 0, len(tableNames))
+	for _, name := range tableNames {
+		m := g.models[name]
+		versions = append(versions, []string{m.ModelStructName, cacheVersion(m)})
 	}
 
 	var dataloaderBuf bytes.Buffer
-	renderErr = render(tpl.DataloaderAgg, &dataloaderBuf, map[string]interface{}{
+	renderErr = g.config.Templates.render("DataloaderAgg", &dataloaderBuf, map[string]interface{}{
 		"Package":        g.config.Package,
-		"ImportPkgPaths": []string{"github.com/redis/go-redis/v9", g.config.ModelPackage, g.config.OrmPackage},
+		"ImportPkgPaths": []string{g.config.ModelPackage, g.config.OrmPackage},
 		"StrFields":      strings.Join(Fields, "\r\n"),
 		"StrInits":       strings.Join(Inits, "\r\n"),
+		"CacheKeyPrefix": prefix,
+		"CacheVersions":  versions,
+		"MaxParams":      g.config.MaxParams,
 	})
-
-	if renderErr == nil {
-		dataloaderBytes = append(dataloaderBytes, dataloaderBuf.Bytes()...)
+	if renderErr != nil {
+		return renderErr
 	}
+	dataloaderBytes = append(dataloaderBytes, dataloaderBuf.Bytes()...)
 
-	outputErr := output(fmt.Sprintf("%s/gen.go", g.config.OutPath), dataloaderBytes)
-	if outputErr != nil {
-
-	}
+	return output(fmt.Sprintf("%s/gen.go", g.config.OutPath), dataloaderBytes)
 }
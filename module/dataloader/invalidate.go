@@ -0,0 +1,114 @@
+package dataloader
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/soedomoto/db2gorm/module/generror"
+	"github.com/soedomoto/db2gorm/properties"
+)
+
+// GenerateInvalidate writes an Invalidate<Model> helper per model with loaders,
+// clearing the keys of every loader generated by GenerateDataloader, and the
+// InvalidatePlugin calling them from gorm callbacks. The plugin reloads the old
+// rows with the primary key and loader key columns only
+func (g *Generator) GenerateInvalidate(d *properties.Databases) error {
+	errs := generror.List{}
+
+	var invalidateBuf bytes.Buffer
+	if err := g.config.Templates.render("Header", &invalidateBuf, map[string]interface{}{
+		"Package":        g.config.Package,
+		"ImportPkgPaths": []string{g.config.ModelPackage, "gorm.io/gorm", "gorm.io/gorm/clause"},
+	}); err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(g.loaders))
+	for name := range g.loaders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	byModel := make(map[string][]map[string]string)
+	columns := make(map[string][]string)
+	models := make([]string, 0)
+	for _, name := range names {
+		l := g.loaders[name]
+
+		conds := make([]string, 0)
+		keyParts := make([]string, 0, len(l.KeyFields))
+		for _, f := range l.KeyFields {
+			Asterisk := ""
+			if strings.Contains(f.Type, "*") {
+				Asterisk = "*"
+				conds = append(conds, fmt.Sprintf("rec.%s != nil", f.Name))
+			}
+			keyParts = append(keyParts, fmt.Sprintf("%s: %srec.%s", f.Name, Asterisk, f.Name))
+		}
+
+		key := strings.SplitN(keyParts[0], ": ", 2)[1]
+		if l.KeyType != "" {
+			key = l.KeyType + "{" + strings.Join(keyParts, ", ") + "}"
+		}
+
+		if _, ok := byModel[l.Model]; !ok {
+			models = append(models, l.Model)
+			for _, m := range g.models {
+				if m.ModelStructName != l.Model {
+					continue
+				}
+				for _, f := range m.Fields {
+					if _, ok := f.GORMTag["primaryKey"]; ok {
+						columns[l.Model] = appendColumn(columns[l.Model], f.ColumnName)
+					}
+				}
+			}
+		}
+		for _, f := range l.KeyFields {
+			columns[l.Model] = appendColumn(columns[l.Model], f.ColumnName)
+		}
+		byModel[l.Model] = append(byModel[l.Model], map[string]string{
+			"Name":      name,
+			"FieldName": l.FieldName,
+			"Cond":      strings.Join(conds, " && "),
+			"Key":       key,
+		})
+	}
+
+	for _, model := range models {
+		if err := g.config.Templates.render("Invalidate", &invalidateBuf, map[string]interface{}{
+			"ModelPkg":        path.Base(g.config.ModelPackage),
+			"ModelStructName": model,
+			"Loaders":         byModel[model],
+		}); err != nil {
+			errs.Add(d.Name, model, "", fmt.Errorf("render: %w", err))
+		}
+	}
+
+	pluginModels := make([]map[string]interface{}, 0, len(models))
+	for _, model := range models {
+		pluginModels = append(pluginModels, map[string]interface{}{"Name": model, "Columns": columns[model]})
+	}
+	if err := g.config.Templates.render("InvalidatePlugin", &invalidateBuf, map[string]interface{}{
+		"ModelPkg": path.Base(g.config.ModelPackage),
+		"Models":   pluginModels,
+	}); err != nil {
+		return err
+	}
+
+	errs.Add(d.Name, "", "", output(filepath.Join(g.config.OutPath, "invalidate.gen.go"), invalidateBuf.Bytes()))
+	return errs.Err()
+}
+
+func appendColumn(columns []string, column string) []string {
+	for _, c := range columns {
+		if c == column {
+			return columns
+		}
+	}
+	return append(columns, column)
+}
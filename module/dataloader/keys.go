@@ -0,0 +1,133 @@
+package dataloader
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/soedomoto/db2gorm/module/schema"
+)
+
+// Key is a set of fields identifying at most one record, the primary key or a
+// unique index
+type Key struct {
+	Name    string
+	Primary bool
+	Fields  []*schema.Field
+}
+
+// FieldName joins the field names of k, e.g. DatapokokIDTglcatatan
+func (k Key) FieldName() string {
+	names := make([]string, 0, len(k.Fields))
+	for _, f := range k.Fields {
+		names = append(names, f.Name)
+	}
+	return strings.Join(names, "")
+}
+
+// Has reports whether k is made of the single field f
+func (k *Key) Has(f *schema.Field) bool {
+	return k != nil && len(k.Fields) == 1 && k.Fields[0] == f
+}
+
+// modelKeys returns the primary key of m first, then its unique indexes by name.
+// The indexes come from m.Indexes, or from the gen field tags when the dialect
+// cannot list them, the tags only keep one unique index per column though
+func modelKeys(m *schema.Table) []Key {
+	byColumn := make(map[string]*schema.Field, len(m.Fields))
+	for _, f := range m.Fields {
+		byColumn[f.ColumnName] = f
+	}
+	fieldsOf := func(columns []string) []*schema.Field {
+		fields := make([]*schema.Field, 0, len(columns))
+		for _, c := range columns {
+			f, ok := byColumn[c]
+			if !ok {
+				return nil
+			}
+			fields = append(fields, f)
+		}
+		return fields
+	}
+
+	var pk *Key
+	uniques := make([]Key, 0)
+	for _, idx := range m.Indexes {
+		fields := fieldsOf(idx.Columns)
+		switch {
+		case len(fields) == 0:
+		case idx.PrimaryKey:
+			pk = &Key{Name: idx.Name, Primary: true, Fields: fields}
+		case idx.Unique:
+			uniques = append(uniques, Key{Name: idx.Name, Fields: fields})
+		}
+	}
+
+	if pk == nil {
+		fields := make([]*schema.Field, 0)
+		for _, f := range m.Fields {
+			if _, ok := f.GORMTag["primaryKey"]; ok {
+				fields = append(fields, f)
+			}
+		}
+		if len(fields) > 0 {
+			pk = &Key{Name: "primaryKey", Primary: true, Fields: fields}
+		}
+	}
+
+	if len(m.Indexes) == 0 {
+		uniques = tagUniqueKeys(m)
+	}
+	sort.SliceStable(uniques, func(i, j int) bool { return uniques[i].Name < uniques[j].Name })
+
+	keys := make([]Key, 0, len(uniques)+1)
+	if pk != nil {
+		keys = append(keys, *pk)
+	}
+	for _, u := range uniques {
+		if pk != nil && u.FieldName() == pk.FieldName() {
+			continue
+		}
+		keys = append(keys, u)
+	}
+	return keys
+}
+
+// tagUniqueKeys reads the uniqueIndex:name,priority:n gen field tags
+func tagUniqueKeys(m *schema.Table) []Key {
+	type member struct {
+		field    *schema.Field
+		priority int
+	}
+	members := make(map[string][]member)
+	names := make([]string, 0)
+	for _, f := range m.Fields {
+		tag, ok := f.GORMTag["uniqueIndex"]
+		if !ok {
+			continue
+		}
+
+		name, priority := tag, 0
+		if i := strings.Index(tag, ",priority:"); i >= 0 {
+			name = tag[:i]
+			priority, _ = strconv.Atoi(tag[i+len(",priority:"):])
+		}
+		if _, ok := members[name]; !ok {
+			names = append(names, name)
+		}
+		members[name] = append(members[name], member{f, priority})
+	}
+
+	keys := make([]Key, 0, len(names))
+	for _, name := range names {
+		ms := members[name]
+		sort.SliceStable(ms, func(i, j int) bool { return ms[i].priority < ms[j].priority })
+
+		key := Key{Name: name}
+		for _, m := range ms {
+			key.Fields = append(key.Fields, m.field)
+		}
+		keys = append(keys, key)
+	}
+	return keys
+}
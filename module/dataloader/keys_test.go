@@ -0,0 +1,72 @@
+package dataloader
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/soedomoto/db2gorm/module/schema"
+	"gorm.io/gen/field"
+)
+
+func keyNames(keys []Key) []string {
+	names := make([]string, 0, len(keys))
+	for _, k := range keys {
+		names = append(names, k.Name+":"+k.FieldName())
+	}
+	return names
+}
+
+func TestModelKeysFromIndexes(t *testing.T) {
+	m := &schema.Table{
+		Name:            "riwayat",
+		ModelStructName: "Riwayat",
+		Fields: []*schema.Field{
+			{Name: "DatapokokID", Type: "int32", ColumnName: "datapokok_id", GORMTag: field.GormTag{"primaryKey": ""}},
+			{Name: "Urut", Type: "int32", ColumnName: "urut", GORMTag: field.GormTag{"primaryKey": ""}},
+			{Name: "Jabatan", Type: "*string", ColumnName: "jabatan"},
+			{Name: "Select_", Type: "string", ColumnName: "select"},
+		},
+		Indexes: []schema.Index{
+			{Name: "uq_select", Columns: []string{"select"}, Unique: true},
+			{Name: "pk_riwayat", Columns: []string{"datapokok_id", "urut"}, PrimaryKey: true, Unique: true},
+			{Name: "uq_jabatan", Columns: []string{"datapokok_id", "jabatan"}, Unique: true},
+			// same columns as the primary key
+			{Name: "uq_urut", Columns: []string{"datapokok_id", "urut"}, Unique: true},
+			{Name: "idx_jabatan", Columns: []string{"jabatan"}},
+		},
+	}
+
+	got := keyNames(modelKeys(m))
+	want := []string{"pk_riwayat:DatapokokIDUrut", "uq_jabatan:DatapokokIDJabatan", "uq_select:Select_"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got keys %v, want %v", got, want)
+	}
+}
+
+func TestModelKeysFromTags(t *testing.T) {
+	// sqlite cannot list the indexes, the gen tags are read instead
+	m := &schema.Table{
+		Name:            "datapokok",
+		ModelStructName: "Datapokok",
+		Fields: []*schema.Field{
+			{Name: "ID", Type: "int32", ColumnName: "id", GORMTag: field.GormTag{"primaryKey": ""}},
+			{Name: "Nip", Type: "string", ColumnName: "nip", GORMTag: field.GormTag{"uniqueIndex": "uq_nip,priority:1"}},
+			{Name: "Tahun", Type: "int32", ColumnName: "tahun", GORMTag: field.GormTag{"uniqueIndex": "uq_nama_tahun,priority:2"}},
+			{Name: "Nama", Type: "string", ColumnName: "nama", GORMTag: field.GormTag{"uniqueIndex": "uq_nama_tahun,priority:1"}},
+			{Name: "Datapendidikans", Type: "[]*Datapendidikan", Relation: &field.Relation{}},
+		},
+	}
+
+	keys := modelKeys(m)
+	got := keyNames(keys)
+	want := []string{"primaryKey:ID", "uq_nama_tahun:NamaTahun", "uq_nip:Nip"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got keys %v, want %v", got, want)
+	}
+	if !keys[0].Primary || !keys[0].Has(m.Fields[0]) {
+		t.Errorf("the first key is not the primary key ID")
+	}
+	if keys[1].Has(m.Fields[3]) {
+		t.Errorf("a composite key reports a single field")
+	}
+}
@@ -0,0 +1,108 @@
+package dataloader
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/soedomoto/db2gorm/module/generror"
+	"github.com/soedomoto/db2gorm/module/schema"
+	"github.com/soedomoto/db2gorm/properties"
+	"gorm.io/gen/field"
+)
+
+func fieldByName(m *schema.Table, name string) *schema.Field {
+	for _, f := range m.Fields {
+		if f.Name == name {
+			return f
+		}
+	}
+	return nil
+}
+
+// GenerateRelations writes a Load<Name>For<Model> helper per relation whose target
+// loader was generated by GenerateDataloader, e.g. LoadDatapokokForDatapendidikan
+// through Datapokok_ID and LoadDatapendidikansForDatapokok through
+// Datapendidikan_DatapokokID
+func (g *Generator) GenerateRelations(d *properties.Databases, relations []schema.Relation) error {
+	errs := generror.List{}
+
+	var relationBuf bytes.Buffer
+	if err := g.config.Templates.render("Header", &relationBuf, map[string]interface{}{
+		"Package":        g.config.Package,
+		"ImportPkgPaths": []string{g.config.ModelPackage},
+	}); err != nil {
+		return err
+	}
+
+	for _, r := range relations {
+		m, ok := g.models[r.Table]
+		target, ok2 := g.models[r.Target]
+		if !ok || !ok2 {
+			continue
+		}
+
+		// the loader is keyed by the target columns, the key is read from m
+		loaderFields, keyFields := r.References, r.ForeignKey
+		reverse := r.Type != field.BelongsTo
+		if reverse {
+			loaderFields, keyFields = r.ForeignKey, r.References
+		}
+		loaderName := target.ModelStructName + "_" + strings.Join(loaderFields, "")
+		l, ok := g.loaders[loaderName]
+		if !ok || (!reverse && !l.Single) || len(l.KeyFields) != len(keyFields) {
+			continue
+		}
+
+		keys := make([]map[string]string, 0, len(keyFields))
+		keyParts := make([]string, 0, len(keyFields))
+		for i, name := range keyFields {
+			f := fieldByName(m, name)
+			if f == nil || strings.ReplaceAll(f.Type, "*", "") != strings.ReplaceAll(l.KeyFields[i].Type, "*", "") {
+				// a warning only, the models and the other loaders are fine
+				log.Printf("relation %s.%s skipped, %s does not match the key of %s", r.Table, r.Name, name, loaderName)
+				keys = nil
+				break
+			}
+
+			Asterisk := ""
+			if strings.Contains(f.Type, "*") {
+				Asterisk = "*"
+			}
+			keys = append(keys, map[string]string{"Field": f.Name, "Asterisk": Asterisk})
+			keyParts = append(keyParts, fmt.Sprintf("%s: %srec.%s", l.KeyFields[i].Name, Asterisk, f.Name))
+		}
+		if keys == nil {
+			continue
+		}
+
+		key := keys[0]["Asterisk"] + "rec." + keys[0]["Field"]
+		if l.KeyType != "" {
+			key = l.KeyType + "{" + strings.Join(keyParts, ", ") + "}"
+		}
+
+		valType := "[]*" + path.Base(g.config.ModelPackage) + "." + target.ModelStructName
+		if l.Single {
+			valType = "*" + path.Base(g.config.ModelPackage) + "." + target.ModelStructName
+		}
+
+		if err := g.config.Templates.render("Relation", &relationBuf, map[string]interface{}{
+			"ModelPkg":        path.Base(g.config.ModelPackage),
+			"ModelStructName": m.ModelStructName,
+			"Name":            r.Name,
+			"Loader":          loaderName,
+			"ValType":         valType,
+			"Keys":            keys,
+			"Key":             key,
+			"UseContext":      d.DataloaderContext,
+		}); err != nil {
+			errs.Add(d.Name, r.Table, r.Name, fmt.Errorf("render: %w", err))
+		}
+	}
+
+	errs.Add(d.Name, "", "", output(filepath.Join(g.config.OutPath, "relation.gen.go"), relationBuf.Bytes()))
+	return errs.Err()
+}
@@ -0,0 +1,39 @@
+package dataloader
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/soedomoto/db2gorm/properties"
+)
+
+func TestRelationKeyMismatch(t *testing.T) {
+	defer func(generate func(string, string, string, string) error) { dataloaden = generate }(dataloaden)
+	dataloaden = func(name, keyType, valueType, wd string) error { return nil }
+
+	out := t.TempDir()
+	g := goldenGenerator(out)
+	s := goldenSchema()
+	// order_item.order_id no longer matches the key of Order_IDLoader
+	s.Table("order_item").Fields[0].Type = "int32"
+
+	d := &properties.Databases{Name: "Golden"}
+	for _, m := range s.Tables {
+		if _, err := g.GenerateDataloader(d, m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := g.GenerateRelations(d, s.Relations); err != nil {
+		t.Fatalf("a skipped relation failed the generation: %v", err)
+	}
+
+	content, err := os.ReadFile(filepath.Join(out, "relation.gen.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(content), "LoadOrderForOrderItem") {
+		t.Errorf("the relation of mismatched keys was generated:\n%s", content)
+	}
+}
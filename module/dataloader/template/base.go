@@ -11,3 +11,18 @@ import(
 	{{range .ImportPkgPaths}}` + "\"" + `{{.}}` + "\"\n" + `{{end}}
 )
 `
+
+// Templates are the default templates by name, a templates_dir overrides them
+// with <name>.tmpl files
+var Templates = map[string]string{
+	"Header":              Header,
+	"LoaderCtx":           LoaderCtx,
+	"DataloaderPk":        DataloaderPk,
+	"DataloaderNpk":       DataloaderNpk,
+	"DataloaderComposite": DataloaderComposite,
+	"DataloaderAgg":       DataloaderAgg,
+	"Cache":               Cache,
+	"Relation":            Relation,
+	"Invalidate":          Invalidate,
+	"InvalidatePlugin":    InvalidatePlugin,
+}
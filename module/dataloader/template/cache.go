@@ -0,0 +1,247 @@
+package template
+
+// Cache is the cache layer of the generated loaders, RedisCache is only emitted
+// with dataloader_use_redis so go-redis stays optional
+const Cache = `
+// Cache stores the serialized loader results, see NoCache, NewLRUCache and NewRedisCache
+type Cache interface {
+	// Get returns ok false on a miss
+	Get(ctx context.Context, key string) (value []byte, ok bool, err error)
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	Delete(ctx context.Context, keys ...string) error
+	// MGet returns one value per key, nil on a miss
+	MGet(ctx context.Context, keys ...string) ([][]byte, error)
+	MSet(ctx context.Context, values map[string][]byte, ttl time.Duration) error
+}
+
+// NoCache never stores anything
+type NoCache struct{}
+
+func (NoCache) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	return nil, false, nil
+}
+
+func (NoCache) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	return nil
+}
+
+func (NoCache) Delete(ctx context.Context, keys ...string) error {
+	return nil
+}
+
+func (NoCache) MGet(ctx context.Context, keys ...string) ([][]byte, error) {
+	return make([][]byte, len(keys)), nil
+}
+
+func (NoCache) MSet(ctx context.Context, values map[string][]byte, ttl time.Duration) error {
+	return nil
+}
+
+// LRUCache is an in-process cache keeping at most size entries (0 = no limit),
+// each one until its ttl (0 = forever)
+type LRUCache struct {
+	mu      sync.Mutex
+	size    int
+	ll      *list.List
+	entries map[string]*list.Element
+	now     func() time.Time
+}
+
+type lruEntry struct {
+	key     string
+	value   []byte
+	expires time.Time
+}
+
+func NewLRUCache(size int) *LRUCache {
+	return &LRUCache{size: size, ll: list.New(), entries: map[string]*list.Element{}, now: time.Now}
+}
+
+func (c *LRUCache) get(key string) ([]byte, bool) {
+	el, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+
+	e := el.Value.(*lruEntry)
+	if !e.expires.IsZero() && c.now().After(e.expires) {
+		c.ll.Remove(el)
+		delete(c.entries, key)
+		return nil, false
+	}
+
+	c.ll.MoveToFront(el)
+	return e.value, true
+}
+
+func (c *LRUCache) set(key string, value []byte, ttl time.Duration) {
+	var expires time.Time
+	if ttl > 0 {
+		expires = c.now().Add(ttl)
+	}
+
+	if el, ok := c.entries[key]; ok {
+		el.Value = &lruEntry{key: key, value: value, expires: expires}
+		c.ll.MoveToFront(el)
+		return
+	}
+
+	c.entries[key] = c.ll.PushFront(&lruEntry{key: key, value: value, expires: expires})
+	if c.size > 0 && c.ll.Len() > c.size {
+		oldest := c.ll.Back()
+		c.ll.Remove(oldest)
+		delete(c.entries, oldest.Value.(*lruEntry).key)
+	}
+}
+
+func (c *LRUCache) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	value, ok := c.get(key)
+	return value, ok, nil
+}
+
+func (c *LRUCache) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.set(key, value, ttl)
+	return nil
+}
+
+func (c *LRUCache) Delete(ctx context.Context, keys ...string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, key := range keys {
+		if el, ok := c.entries[key]; ok {
+			c.ll.Remove(el)
+			delete(c.entries, key)
+		}
+	}
+	return nil
+}
+
+func (c *LRUCache) MGet(ctx context.Context, keys ...string) ([][]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	values := make([][]byte, len(keys))
+	for i, key := range keys {
+		values[i], _ = c.get(key)
+	}
+	return values, nil
+}
+
+func (c *LRUCache) MSet(ctx context.Context, values map[string][]byte, ttl time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for key, value := range values {
+		c.set(key, value, ttl)
+	}
+	return nil
+}
+{{if .UseRedis}}
+// RedisCache stores the entries in redis, client can be a *redis.Client,
+// *redis.ClusterClient or *redis.Ring
+type RedisCache struct {
+	client redis.UniversalClient
+}
+
+func NewRedisCache(client redis.UniversalClient) *RedisCache {
+	return &RedisCache{client: client}
+}
+
+func (c *RedisCache) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	value, err := c.client.Get(ctx, key).Bytes()
+	if err == redis.Nil {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return value, true, nil
+}
+
+func (c *RedisCache) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	return c.client.Set(ctx, key, value, ttl).Err()
+}
+
+// Delete is a single DEL, on a cluster or a ring one DEL per key is pipelined
+// instead because the keys of a record hash to different slots or shards
+func (c *RedisCache) Delete(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+
+	switch c.client.(type) {
+	case *redis.ClusterClient, *redis.Ring:
+		_, err := c.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+			for _, key := range keys {
+				pipe.Del(ctx, key)
+			}
+			return nil
+		})
+		return err
+	}
+
+	return c.client.Del(ctx, keys...).Err()
+}
+
+// MGet is a single MGET, on a cluster or a ring the GETs are pipelined instead
+// because MGET needs every key in the same slot or shard
+func (c *RedisCache) MGet(ctx context.Context, keys ...string) ([][]byte, error) {
+	values := make([][]byte, len(keys))
+	if len(keys) == 0 {
+		return values, nil
+	}
+
+	switch c.client.(type) {
+	case *redis.ClusterClient, *redis.Ring:
+		cmds := make([]*redis.StringCmd, len(keys))
+		_, err := c.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+			for i, key := range keys {
+				cmds[i] = pipe.Get(ctx, key)
+			}
+			return nil
+		})
+		if err != nil && err != redis.Nil {
+			return nil, err
+		}
+		for i, cmd := range cmds {
+			if value, err := cmd.Bytes(); err == nil {
+				values[i] = value
+			}
+		}
+		return values, nil
+	}
+
+	results, err := c.client.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, err
+	}
+	for i, result := range results {
+		if value, ok := result.(string); ok {
+			values[i] = []byte(value)
+		}
+	}
+	return values, nil
+}
+
+// MSet pipelines one SET with ttl per entry, redis MSET cannot expire keys
+func (c *RedisCache) MSet(ctx context.Context, values map[string][]byte, ttl time.Duration) error {
+	if len(values) == 0 {
+		return nil
+	}
+
+	_, err := c.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for key, value := range values {
+			pipe.Set(ctx, key, value, ttl)
+		}
+		return nil
+	})
+	return err
+}
+{{end}}`
@@ -1,71 +1,137 @@
 package template
 
 const DataloaderPk = `
-func Get{{.ModelStructName}}_{{.FieldName}}Loader(Q *orm.Query, redisClient *redis.Client) *{{.ModelStructName}}_{{.FieldName}}Loader {
+func Get{{.ModelStructName}}_{{.FieldName}}Loader(Q *orm.Query, cache Cache, opts ...LoaderOptions) *{{.ModelStructName}}_{{.FieldName}}Loader {
+	o := mergeLoaderOptions(LoaderOptions{
+		Wait:        {{duration .Wait}},
+		MaxBatch:    {{.MaxBatch}},
+		CacheTTL:    {{duration .CacheTTL}},
+		ChunkSize:   {{.ChunkSize}},
+		Concurrency: {{.Concurrency}},
+		NegativeCacheTTL: {{duration .NegativeCacheTTL}},
+	}, opts...)
+	o.ChunkSize = clampChunkSize(o.ChunkSize, {{.KeyParams}})
+	{{if .UseCache}}
+	if cache == nil {
+		cache = NoCache{}
+	}
+	{{end}}
+
 	return &{{.ModelStructName}}_{{.FieldName}}Loader{
-		wait:     2 * time.Millisecond,
-		maxBatch: 100,
-		fetch: func(keys []{{.Fieldtype}}) ([]*model.{{.ModelStructName}}, []error) {
+		wait:     o.Wait,
+		maxBatch: o.MaxBatch,
+		fetch: func({{if .UseContext}}ctx context.Context, {{end}}keys []{{.Fieldtype}}) ([]*{{.ModelPkg}}.{{.ModelStructName}}, []error) {
 			resKeys := make([]{{.Fieldtype}}, 0)
-			data := make([]*model.{{.ModelStructName}}, len(keys))
+			data := make([]*{{.ModelPkg}}.{{.ModelStructName}}, len(keys))
 			errs := make([]error, len(keys))
+			{{if not .UseContext}}
+			ctx := context.Background()
+			{{end}}
 
-			{{if .UseRedis}}
+			{{if .UseCache}}
+			cacheKeys := make([]string, len(keys))
 			for i, key := range keys {
-				strKey, _ := json.Marshal(key)
-				strRec, err := redisClient.Get(context.Background(), fmt.Sprintf("%s_%s_%s", "{{.ModelStructName}}", "{{.FieldName}}", string(strKey))).Result()
+				cacheKeys[i] = cacheKey("{{.ModelStructName}}", "{{.FieldName}}", key)
+			}
 
-				if err != nil {
-					resKeys = append(resKeys, key)
+			miss := make([]bool, len(keys))
+			cached, cacheErr := cache.MGet(ctx, cacheKeys...)
+			if cacheErr != nil {
+				o.Logger.Error(ctx, &LoadError{Kind: ErrCache, Op: "get", Model: "{{.ModelStructName}}", Field: "{{.FieldName}}", Err: cacheErr})
+			}
+			if cacheErr != nil || len(cached) != len(keys) {
+				cached = make([][]byte, len(keys))
+			}
+
+			for i, key := range keys {
+				if cached[i] == nil {
+					resKeys, miss[i] = append(resKeys, key), true
 					continue
 				}
 
-				var rec *model.{{.ModelStructName}}
-				err2 := json.Unmarshal([]byte(strRec), &rec)
+				var rec *{{.ModelPkg}}.{{.ModelStructName}}
+				err2 := json.Unmarshal(cached[i], &rec)
 
 				if err2 != nil {
-					resKeys = append(resKeys, key)
+					o.Logger.Error(ctx, &LoadError{Kind: ErrCache, Op: "decode", Model: "{{.ModelStructName}}", Field: "{{.FieldName}}", Key: key, Err: err2})
+					resKeys, miss[i] = append(resKeys, key), true
 					continue
 				}
 
+				// a negative entry decodes to nil
 				data[i] = rec
 			}
 			{{else}}
 			resKeys = keys
 			{{end}}
 
-			recs := make([]*model.{{.ModelStructName}}, 0)
-			var err error
 
+			recs := make([]*{{.ModelPkg}}.{{.ModelStructName}}, 0)
+			fetchErrs := make(map[{{.Fieldtype}}]error)
 			if len(resKeys) > 0 {
-				recs, err = Q.{{.ModelStructName}}.Where(Q.{{.ModelStructName}}.{{.FieldName}}.In(resKeys...)).Find()
+				recs, fetchErrs = fetchChunks(ctx, resKeys, o.ChunkSize, o.Concurrency, func(ctx context.Context, chunk []{{.Fieldtype}}) ([]*{{.ModelPkg}}.{{.ModelStructName}}, error) {
+					return Q.{{.ModelStructName}}.WithContext(ctx).Where(Q.{{.ModelStructName}}.{{.FieldName}}.In(chunk...)).Find()
+				})
 			}
 
-			if err != nil {
-				for i := range keys {
-					errs[i] = err
+			{{if .UseCache}}
+			toCache := make(map[string][]byte)
+			notFound := make(map[string][]byte)
+			{{end}}
+			byKey := make(map[{{.Fieldtype}}]*{{.ModelPkg}}.{{.ModelStructName}}, len(recs))
+			for _, rec := range recs {
+				{{if .Asterisk}}
+				if rec.{{.FieldName}} == nil {
+					continue
 				}
-				return nil, errs
+				{{end}}
+				byKey[{{.Asterisk}}rec.{{.FieldName}}] = rec
 			}
 
 			for i, key := range keys {
-				for _, rec := range recs {
-					if key == {{.Asterisk}}rec.{{.FieldName}} {
-						data[i] = rec
-
-						{{if .UseRedis}}
-						strKey, _ := json.Marshal(key)
-						strRec, _ := json.Marshal(rec)
-						err := redisClient.Set(context.Background(), fmt.Sprintf("%s_%s_%s", "{{.ModelStructName}}", "{{.FieldName}}", string(strKey)), string(strRec), 30 * time.Second).Err()
-						if err != nil {
-
-						}
-						{{end}}
+				if err, ok := fetchErrs[key]; ok {
+					errs[i] = &LoadError{Kind: ErrDatabase, Op: "query", Model: "{{.ModelStructName}}", Field: "{{.FieldName}}", Key: key, Err: err}
+					continue
+				}
+
+				rec, ok := byKey[key]
+				if !ok {
+					{{if .UseCache}}
+					if miss[i] && o.NegativeCacheTTL > 0 {
+						notFound[cacheKeys[i]] = []byte("null")
+					}
+					{{end}}
+					{{if .NotFoundError}}
+					if data[i] == nil {
+						errs[i] = &NotFoundError{Model: "{{.ModelStructName}}", Field: "{{.FieldName}}", Key: key}
 					}
+					{{end}}
+					continue
+				}
+				data[i] = rec
+
+				{{if .UseCache}}
+				strRec, _ := json.Marshal(rec)
+				toCache[cacheKeys[i]] = strRec
+				{{end}}
+			}
+
+			{{if .UseCache}}
+			if len(toCache) > 0 {
+				err := cache.MSet(ctx, toCache, o.CacheTTL)
+				if err != nil {
+					o.Logger.Error(ctx, &LoadError{Kind: ErrCache, Op: "set", Model: "{{.ModelStructName}}", Field: "{{.FieldName}}", Err: err})
+				}
+			}
+			if len(notFound) > 0 {
+				err := cache.MSet(ctx, notFound, o.NegativeCacheTTL)
+				if err != nil {
+					o.Logger.Error(ctx, &LoadError{Kind: ErrCache, Op: "set", Model: "{{.ModelStructName}}", Field: "{{.FieldName}}", Err: err})
 				}
 			}
+			{{end}}
 
-			return data, nil
+			return data, errs
 		},
 	}
 }
@@ -73,30 +139,59 @@ func Get{{.ModelStructName}}_{{.FieldName}}Loader(Q *orm.Query, redisClient *red
 `
 
 const DataloaderNpk = `
-func Get{{.ModelStructName}}_{{.FieldName}}Loader(Q *orm.Query, redisClient *redis.Client) *{{.ModelStructName}}_{{.FieldName}}Loader {
+func Get{{.ModelStructName}}_{{.FieldName}}Loader(Q *orm.Query, cache Cache, opts ...LoaderOptions) *{{.ModelStructName}}_{{.FieldName}}Loader {
+	o := mergeLoaderOptions(LoaderOptions{
+		Wait:        {{duration .Wait}},
+		MaxBatch:    {{.MaxBatch}},
+		CacheTTL:    {{duration .CacheTTL}},
+		ChunkSize:   {{.ChunkSize}},
+		Concurrency: {{.Concurrency}},
+	}, opts...)
+	o.ChunkSize = clampChunkSize(o.ChunkSize, {{.KeyParams}})
+	{{if .UseCache}}
+	if cache == nil {
+		cache = NoCache{}
+	}
+	{{end}}
+
 	return &{{.ModelStructName}}_{{.FieldName}}Loader{
-		wait:     2 * time.Millisecond,
-		maxBatch: 100,
-		fetch: func(keys []{{.Fieldtype}}) ([][]*model.{{.ModelStructName}}, []error) {
+		wait:     o.Wait,
+		maxBatch: o.MaxBatch,
+		fetch: func({{if .UseContext}}ctx context.Context, {{end}}keys []{{.Fieldtype}}) ([][]*{{.ModelPkg}}.{{.ModelStructName}}, []error) {
 			resKeys := make([]{{.Fieldtype}}, 0)
-			data := make([][]*model.{{.ModelStructName}}, len(keys))
+			data := make([][]*{{.ModelPkg}}.{{.ModelStructName}}, len(keys))
 			errs := make([]error, len(keys))
+			{{if not .UseContext}}
+			ctx := context.Background()
+			{{end}}
 
-			{{if .UseRedis}}
+			{{if .UseCache}}
+			cacheKeys := make([]string, len(keys))
 			for i, key := range keys {
-				strKey, _ := json.Marshal(key)
-				strRec, err := redisClient.Get(context.Background(), fmt.Sprintf("%s_%s_%s", "{{.ModelStructName}}", "{{.FieldName}}", string(strKey))).Result()
+				cacheKeys[i] = cacheKey("{{.ModelStructName}}", "{{.FieldName}}", key)
+			}
 
-				if err != nil {
-					resKeys = append(resKeys, key)
+			miss := make([]bool, len(keys))
+			cached, cacheErr := cache.MGet(ctx, cacheKeys...)
+			if cacheErr != nil {
+				o.Logger.Error(ctx, &LoadError{Kind: ErrCache, Op: "get", Model: "{{.ModelStructName}}", Field: "{{.FieldName}}", Err: cacheErr})
+			}
+			if cacheErr != nil || len(cached) != len(keys) {
+				cached = make([][]byte, len(keys))
+			}
+
+			for i, key := range keys {
+				if cached[i] == nil {
+					resKeys, miss[i] = append(resKeys, key), true
 					continue
 				}
 
-				var recs []*model.{{.ModelStructName}}
-				err2 := json.Unmarshal([]byte(strRec), &recs)
+				var recs []*{{.ModelPkg}}.{{.ModelStructName}}
+				err2 := json.Unmarshal(cached[i], &recs)
 
 				if err2 != nil {
-					resKeys = append(resKeys, key)
+					o.Logger.Error(ctx, &LoadError{Kind: ErrCache, Op: "decode", Model: "{{.ModelStructName}}", Field: "{{.FieldName}}", Key: key, Err: err2})
+					resKeys, miss[i] = append(resKeys, key), true
 					continue
 				}
 
@@ -106,38 +201,217 @@ func Get{{.ModelStructName}}_{{.FieldName}}Loader(Q *orm.Query, redisClient *red
 			resKeys = keys
 			{{end}}
 
-			recs := make([]*model.{{.ModelStructName}}, 0)
-			var err error
 
+			recs := make([]*{{.ModelPkg}}.{{.ModelStructName}}, 0)
+			fetchErrs := make(map[{{.Fieldtype}}]error)
 			if len(resKeys) > 0 {
-				recs, err = Q.{{.ModelStructName}}.Where(Q.{{.ModelStructName}}.{{.FieldName}}.In(resKeys...)).Find()
+				recs, fetchErrs = fetchChunks(ctx, resKeys, o.ChunkSize, o.Concurrency, func(ctx context.Context, chunk []{{.Fieldtype}}) ([]*{{.ModelPkg}}.{{.ModelStructName}}, error) {
+					return Q.{{.ModelStructName}}.WithContext(ctx).Where(Q.{{.ModelStructName}}.{{.FieldName}}.In(chunk...)).Find()
+				})
 			}
 
-			if err != nil {
-				for i := range keys {
-					errs[i] = err
+			{{if .UseCache}}
+			toCache := make(map[string][]byte)
+			{{end}}
+			byKey := make(map[{{.Fieldtype}}][]*{{.ModelPkg}}.{{.ModelStructName}})
+			for _, rec := range recs {
+				{{if .Asterisk}}
+				if rec.{{.FieldName}} == nil {
+					continue
 				}
-				return nil, errs
+				{{end}}
+				byKey[{{.Asterisk}}rec.{{.FieldName}}] = append(byKey[{{.Asterisk}}rec.{{.FieldName}}], rec)
 			}
 
 			for i, key := range keys {
-				for _, rec := range recs {
-					if key == {{.Asterisk}}rec.{{.FieldName}} {
-						data[i] = append(data[i], rec)
-					}
+				if err, ok := fetchErrs[key]; ok {
+					errs[i] = &LoadError{Kind: ErrDatabase, Op: "query", Model: "{{.ModelStructName}}", Field: "{{.FieldName}}", Key: key, Err: err}
+					continue
 				}
 
-				{{if .UseRedis}}
-				strKey, _ := json.Marshal(key)
+				{{if .UseCache}}
+				// a hit is left as cached, writing it back would push its expiry
+				if !miss[i] {
+					continue
+				}
+				{{end}}
+				data[i] = append(data[i], byKey[key]...)
+
+				{{if .UseCache}}
 				strRec, _ := json.Marshal(data[i])
-				err := redisClient.Set(context.Background(), fmt.Sprintf("%s_%s_%s", "Datacatatan", "Tglcatatan", string(strKey)), string(strRec), 30*time.Second).Err()
+				toCache[cacheKeys[i]] = strRec
+				{{end}}
+			}
+
+			{{if .UseCache}}
+			if len(toCache) > 0 {
+				err := cache.MSet(ctx, toCache, o.CacheTTL)
 				if err != nil {
+					o.Logger.Error(ctx, &LoadError{Kind: ErrCache, Op: "set", Model: "{{.ModelStructName}}", Field: "{{.FieldName}}", Err: err})
+				}
+			}
+			{{end}}
+
+			return data, errs
+		},
+	}
+}
 
+`
+
+const DataloaderComposite = `
+// {{.KeyType}} is the {{.IndexName}} key of {{.ModelStructName}}
+type {{.KeyType}} struct {
+{{- range .KeyFields}}
+	{{.Name}} {{.Type}}
+{{- end}}
+}
+
+func Get{{.ModelStructName}}_{{.FieldName}}Loader(Q *orm.Query, cache Cache, opts ...LoaderOptions) *{{.ModelStructName}}_{{.FieldName}}Loader {
+	o := mergeLoaderOptions(LoaderOptions{
+		Wait:        {{duration .Wait}},
+		MaxBatch:    {{.MaxBatch}},
+		CacheTTL:    {{duration .CacheTTL}},
+		ChunkSize:   {{.ChunkSize}},
+		Concurrency: {{.Concurrency}},
+		NegativeCacheTTL: {{duration .NegativeCacheTTL}},
+	}, opts...)
+	o.ChunkSize = clampChunkSize(o.ChunkSize, {{.KeyParams}})
+	{{if .UseCache}}
+	if cache == nil {
+		cache = NoCache{}
+	}
+	{{end}}
+
+	return &{{.ModelStructName}}_{{.FieldName}}Loader{
+		wait:     o.Wait,
+		maxBatch: o.MaxBatch,
+		fetch: func({{if .UseContext}}ctx context.Context, {{end}}keys []{{.KeyType}}) ([]*{{.ModelPkg}}.{{.ModelStructName}}, []error) {
+			resKeys := make([]{{.KeyType}}, 0)
+			data := make([]*{{.ModelPkg}}.{{.ModelStructName}}, len(keys))
+			errs := make([]error, len(keys))
+			{{if not .UseContext}}
+			ctx := context.Background()
+			{{end}}
+
+			{{if .UseCache}}
+			cacheKeys := make([]string, len(keys))
+			for i, key := range keys {
+				cacheKeys[i] = cacheKey("{{.ModelStructName}}", "{{.FieldName}}", key)
+			}
+
+			miss := make([]bool, len(keys))
+			cached, cacheErr := cache.MGet(ctx, cacheKeys...)
+			if cacheErr != nil {
+				o.Logger.Error(ctx, &LoadError{Kind: ErrCache, Op: "get", Model: "{{.ModelStructName}}", Field: "{{.FieldName}}", Err: cacheErr})
+			}
+			if cacheErr != nil || len(cached) != len(keys) {
+				cached = make([][]byte, len(keys))
+			}
+
+			for i, key := range keys {
+				if cached[i] == nil {
+					resKeys, miss[i] = append(resKeys, key), true
+					continue
+				}
+
+				var rec *{{.ModelPkg}}.{{.ModelStructName}}
+				err2 := json.Unmarshal(cached[i], &rec)
+
+				if err2 != nil {
+					o.Logger.Error(ctx, &LoadError{Kind: ErrCache, Op: "decode", Model: "{{.ModelStructName}}", Field: "{{.FieldName}}", Key: key, Err: err2})
+					resKeys, miss[i] = append(resKeys, key), true
+					continue
 				}
+
+				// a negative entry decodes to nil
+				data[i] = rec
+			}
+			{{else}}
+			resKeys = keys
+			{{end}}
+
+
+			recs := make([]*{{.ModelPkg}}.{{.ModelStructName}}, 0)
+			fetchErrs := make(map[{{.KeyType}}]error)
+			if len(resKeys) > 0 {
+				recs, fetchErrs = fetchChunks(ctx, resKeys, o.ChunkSize, o.Concurrency, func(ctx context.Context, chunk []{{.KeyType}}) ([]*{{.ModelPkg}}.{{.ModelStructName}}, error) {
+					conds := make([]field.Expr, len(chunk))
+					for i, key := range chunk {
+						conds[i] = field.And(
+						{{- range .KeyFields}}
+							Q.{{$.ModelStructName}}.{{.Name}}.Eq(key.{{.Name}}),
+						{{- end}}
+						)
+					}
+					return Q.{{.ModelStructName}}.WithContext(ctx).Where(field.Or(conds...)).Find()
+				})
+			}
+
+			{{if .UseCache}}
+			toCache := make(map[string][]byte)
+			notFound := make(map[string][]byte)
+			{{end}}
+			byKey := make(map[{{.KeyType}}]*{{.ModelPkg}}.{{.ModelStructName}}, len(recs))
+			for _, rec := range recs {
+				{{- range .KeyFields}}
+				{{- if .Asterisk}}
+				if rec.{{.Name}} == nil {
+					continue
+				}
+				{{- end}}
+				{{- end}}
+				byKey[{{.KeyType}}{
+				{{- range .KeyFields}}
+					{{.Name}}: {{.Asterisk}}rec.{{.Name}},
+				{{- end}}
+				}] = rec
+			}
+
+			for i, key := range keys {
+				if err, ok := fetchErrs[key]; ok {
+					errs[i] = &LoadError{Kind: ErrDatabase, Op: "query", Model: "{{.ModelStructName}}", Field: "{{.FieldName}}", Key: key, Err: err}
+					continue
+				}
+
+				rec, ok := byKey[key]
+				if !ok {
+					{{if .UseCache}}
+					if miss[i] && o.NegativeCacheTTL > 0 {
+						notFound[cacheKeys[i]] = []byte("null")
+					}
+					{{end}}
+					{{if .NotFoundError}}
+					if data[i] == nil {
+						errs[i] = &NotFoundError{Model: "{{.ModelStructName}}", Field: "{{.FieldName}}", Key: key}
+					}
+					{{end}}
+					continue
+				}
+				data[i] = rec
+
+				{{if .UseCache}}
+				strRec, _ := json.Marshal(rec)
+				toCache[cacheKeys[i]] = strRec
 				{{end}}
 			}
 
-			return data, nil
+			{{if .UseCache}}
+			if len(toCache) > 0 {
+				err := cache.MSet(ctx, toCache, o.CacheTTL)
+				if err != nil {
+					o.Logger.Error(ctx, &LoadError{Kind: ErrCache, Op: "set", Model: "{{.ModelStructName}}", Field: "{{.FieldName}}", Err: err})
+				}
+			}
+			if len(notFound) > 0 {
+				err := cache.MSet(ctx, notFound, o.NegativeCacheTTL)
+				if err != nil {
+					o.Logger.Error(ctx, &LoadError{Kind: ErrCache, Op: "set", Model: "{{.ModelStructName}}", Field: "{{.FieldName}}", Err: err})
+				}
+			}
+			{{end}}
+
+			return data, errs
 		},
 	}
 }
@@ -145,11 +419,259 @@ func Get{{.ModelStructName}}_{{.FieldName}}Loader(Q *orm.Query, redisClient *red
 `
 
 const DataloaderAgg = `
+// LoaderOptions overrides the generated loader settings at runtime, zero values keep them
+type LoaderOptions struct {
+	Wait        time.Duration
+	MaxBatch    int
+	CacheTTL    time.Duration
+	ChunkSize   int // keys per IN query, 0 = all keys in one query
+	Concurrency int // IN queries running at once
+	// NegativeCacheTTL caches the keys without record of the single record
+	// loaders, 0 keeps the generated value, a negative value turns it off
+	NegativeCacheTTL time.Duration
+	// Logger receives the cache failures, nil = DefaultLogger
+	Logger Logger
+}
+
+var (
+	// ErrDatabase matches, with errors.Is, the LoadError of a failed query
+	ErrDatabase = errors.New("database")
+	// ErrCache matches, with errors.Is, the LoadError of a failed cache read or write
+	ErrCache = errors.New("cache")
+)
+
+// ErrLoaderNotSet is returned by the relation helpers before SetDefault
+var ErrLoaderNotSet = errors.New("loader not set, call SetDefault first")
+
+// LoadError is a failure of a loader, errors.Is matches its Kind and its cause.
+// Database failures are returned for the keys of the failed query, cache
+// failures go to the Logger and the keys are loaded from the database
+type LoadError struct {
+	Kind  error  // ErrDatabase or ErrCache
+	Op    string // query, wait, get, decode or set
+	Model string
+	Field string
+	Key   interface{} // nil when the failure is not about one key
+	Err   error
+}
+
+func (e *LoadError) Error() string {
+	if e.Key == nil {
+		return fmt.Sprintf("%s %s: %s %s: %v", e.Model, e.Field, e.Kind, e.Op, e.Err)
+	}
+	strKey, _ := json.Marshal(e.Key)
+	return fmt.Sprintf("%s %s %s: %s %s: %v", e.Model, e.Field, strKey, e.Kind, e.Op, e.Err)
+}
+
+func (e *LoadError) Is(target error) bool {
+	return target == e.Kind
+}
+
+func (e *LoadError) Unwrap() error {
+	return e.Err
+}
+
+// Logger receives the cache failures of the loaders
+type Logger interface {
+	Error(ctx context.Context, err error)
+}
+
+// LoggerFunc is a Logger calling f
+type LoggerFunc func(ctx context.Context, err error)
+
+func (f LoggerFunc) Error(ctx context.Context, err error) {
+	f(ctx, err)
+}
+
+// DefaultLogger is the Logger of the loaders without LoaderOptions.Logger
+var DefaultLogger Logger = LoggerFunc(func(ctx context.Context, err error) {
+	log.Printf("dataloader: %v", err)
+})
+
+// ErrNotFound matches, with errors.Is, the NotFoundError of a key without record
+var ErrNotFound = errors.New("record not found")
+
+// NotFoundError is the error of a key without record in a single record loader,
+// with dataloader_not_found_error
+type NotFoundError struct {
+	Model string
+	Field string
+	Key   interface{}
+}
+
+func (e *NotFoundError) Error() string {
+	strKey, _ := json.Marshal(e.Key)
+	return fmt.Sprintf("%s %s %s: %s", e.Model, e.Field, strKey, ErrNotFound)
+}
+
+func (e *NotFoundError) Is(target error) bool {
+	return target == ErrNotFound
+}
+
+func mergeLoaderOptions(o LoaderOptions, opts ...LoaderOptions) LoaderOptions {
+	for _, opt := range opts {
+		if opt.Wait > 0 {
+			o.Wait = opt.Wait
+		}
+		if opt.MaxBatch > 0 {
+			o.MaxBatch = opt.MaxBatch
+		}
+		if opt.CacheTTL > 0 {
+			o.CacheTTL = opt.CacheTTL
+		}
+		if opt.ChunkSize > 0 {
+			o.ChunkSize = opt.ChunkSize
+		}
+		if opt.Concurrency > 0 {
+			o.Concurrency = opt.Concurrency
+		}
+		if opt.NegativeCacheTTL != 0 {
+			o.NegativeCacheTTL = opt.NegativeCacheTTL
+		}
+		if opt.Logger != nil {
+			o.Logger = opt.Logger
+		}
+	}
+	if o.Logger == nil {
+		o.Logger = DefaultLogger
+	}
+	return o
+}
+
+// CacheKeyPrefix starts every cache key, the dataloader_cache_prefix and the
+// database name of db2gorm.yml
+var CacheKeyPrefix = {{printf "%q" .CacheKeyPrefix}}
+
+// cacheVersions hashes the fields of every model at generation time, a column
+// change moves its entries to new keys so old payloads are never decoded
+var cacheVersions = map[string]string{
+{{- range .CacheVersions}}
+	"{{index . 0}}": "{{index . 1}}",
+{{- end}}
+}
+
+// detachedContext keeps the values of a context, e.g. a tracing span, without its
+// deadline and cancellation, a batch must outlive the caller that started it
+type detachedContext struct {
+	context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool) {
+	return time.Time{}, false
+}
+
+func (detachedContext) Done() <-chan struct{} {
+	return nil
+}
+
+func (detachedContext) Err() error {
+	return nil
+}
+
+// cacheKey is the cache entry of key in the loader of model and field,
+// <prefix>:<database>:<model>:<version>:<field>:<json key>
+func cacheKey(model, field string, key interface{}) string {
+	strKey, _ := json.Marshal(key)
+	return fmt.Sprintf("%s%s:%s:%s:%s", CacheKeyPrefix, model, cacheVersions[model], field, string(strKey))
+}
+
+// maxInParams is the number of parameters one query may bind on the dialect,
+// 0 = no limit
+const maxInParams = {{.MaxParams}}
+
+// clampChunkSize keeps a chunk of keys binding params parameters each under
+// maxInParams, whatever LoaderOptions.ChunkSize asks for
+func clampChunkSize(size, params int) int {
+	if maxInParams == 0 {
+		return size
+	}
+	if limit := maxInParams / params; size <= 0 || size > limit {
+		return limit
+	}
+	return size
+}
+
+// fetchChunks runs fetch over keys split in chunks of size, at most concurrency
+// chunks at once, and returns the records in chunk order with the error of
+// every key of a failed chunk. Once a chunk fails no other chunk is run, their
+// keys get that error
+func fetchChunks[K comparable, V any](ctx context.Context, keys []K, size, concurrency int, fetch func(ctx context.Context, chunk []K) ([]V, error)) ([]V, map[K]error) {
+	chunks := [][]K{keys}
+	if size > 0 && len(keys) > size {
+		chunks = make([][]K, 0, (len(keys)+size-1)/size)
+		for size < len(keys) {
+			keys, chunks = keys[size:], append(chunks, keys[:size])
+		}
+		chunks = append(chunks, keys)
+	}
+
+	results := make([][]V, len(chunks))
+	errs := make([]error, len(chunks))
+	if concurrency <= 1 || len(chunks) == 1 {
+		var stopErr error
+		for i, chunk := range chunks {
+			if stopErr != nil {
+				errs[i] = stopErr
+				continue
+			}
+			if results[i], errs[i] = fetch(ctx, chunk); errs[i] != nil {
+				stopErr = errs[i]
+			}
+		}
+	} else {
+		var (
+			wg      sync.WaitGroup
+			mu      sync.Mutex
+			stopErr error // the first failure, no chunk is launched after it
+		)
+		sem := make(chan struct{}, concurrency)
+		for i, chunk := range chunks {
+			sem <- struct{}{}
+			mu.Lock()
+			err := stopErr
+			mu.Unlock()
+			if err != nil {
+				<-sem
+				errs[i] = err
+				continue
+			}
+
+			wg.Add(1)
+			go func(i int, chunk []K) {
+				defer wg.Done()
+				defer func() { <-sem }()
+				results[i], errs[i] = fetch(ctx, chunk)
+				if errs[i] != nil {
+					mu.Lock()
+					if stopErr == nil {
+						stopErr = errs[i]
+					}
+					mu.Unlock()
+				}
+			}(i, chunk)
+		}
+		wg.Wait()
+	}
+
+	recs := make([]V, 0)
+	failed := make(map[K]error)
+	for i, chunk := range chunks {
+		if errs[i] != nil {
+			for _, key := range chunk {
+				failed[key] = errs[i]
+			}
+			continue
+		}
+		recs = append(recs, results[i]...)
+	}
+	return recs, failed
+}
+
 var (
 	{{.StrFields}}
 )
 
-func SetDefault(Q *orm.Query, redisClient *redis.Client) {
+func SetDefault(Q *orm.Query, cache Cache, opts ...LoaderOptions) {
 	{{.StrInits}}
 }
 
@@ -0,0 +1,173 @@
+package template
+
+// Invalidate clears the cache entries and the SetDefault loader entries of a
+// record, one helper per model
+const Invalidate = `
+// Invalidate{{.ModelStructName}} clears every loader key of recs from cache and from the
+// loaders set by SetDefault. Pass the old record too when a key column changed
+func Invalidate{{.ModelStructName}}(ctx context.Context, cache Cache, recs ...*{{.ModelPkg}}.{{.ModelStructName}}) error {
+	keys := make([]string, 0, len(recs)*{{len .Loaders}})
+	for _, rec := range recs {
+		if rec == nil {
+			continue
+		}
+		{{- range .Loaders}}
+		{{if .Cond}}if {{.Cond}} {{end}}{
+			key := {{.Key}}
+			keys = append(keys, cacheKey("{{$.ModelStructName}}", "{{.FieldName}}", key))
+			if {{.Name}} != nil {
+				{{.Name}}.Clear(key)
+			}
+		}
+		{{- end}}
+	}
+
+	if cache == nil || len(keys) == 0 {
+		return nil
+	}
+	return cache.Delete(ctx, keys...)
+}
+`
+
+// InvalidatePlugin calls the Invalidate helpers from gorm callbacks
+const InvalidatePlugin = `
+// InvalidatePlugin is a gorm plugin calling the Invalidate helpers after every
+// committed create, update and delete, register it with db.Use(NewInvalidatePlugin(cache)).
+// The rows an update or delete is about to change are reloaded first, by the
+// primary keys of the statement model and its conditions, so the keys they had
+// are cleared together with the new ones. That is one more SELECT per update or
+// delete, in its transaction, of the primary key and loader key columns only.
+//
+// Inside db.Transaction the callbacks run at the end of each statement, before the
+// outer commit, a read between both can cache the old row again until its TTL.
+// Call the Invalidate helpers after the transaction commits there
+type InvalidatePlugin struct {
+	cache Cache
+}
+
+func NewInvalidatePlugin(cache Cache) *InvalidatePlugin {
+	return &InvalidatePlugin{cache: cache}
+}
+
+func (p *InvalidatePlugin) Name() string {
+	return "db2gorm:invalidate"
+}
+
+// invalidateOldKey holds the rows reloaded before an update or delete in the statement
+const invalidateOldKey = "db2gorm:invalidate:old"
+
+func (p *InvalidatePlugin) Initialize(db *gorm.DB) error {
+	// a create clears the negative cache entries of the new keys
+	err := db.Callback().Create().After("gorm:commit_or_rollback_transaction").Register(p.Name(), p.invalidate)
+	if err != nil {
+		return err
+	}
+	err = db.Callback().Update().Before("gorm:update").Register(p.Name()+":old", p.loadOld)
+	if err != nil {
+		return err
+	}
+	err = db.Callback().Update().After("gorm:commit_or_rollback_transaction").Register(p.Name(), p.invalidate)
+	if err != nil {
+		return err
+	}
+	err = db.Callback().Delete().Before("gorm:delete").Register(p.Name()+":old", p.loadOld)
+	if err != nil {
+		return err
+	}
+	return db.Callback().Delete().After("gorm:commit_or_rollback_transaction").Register(p.Name(), p.invalidate)
+}
+
+// loadOld reloads the rows matched by the statement, in its transaction, before they change
+func (p *InvalidatePlugin) loadOld(tx *gorm.DB) {
+	stmt := tx.Statement
+	if tx.Error != nil || stmt.Schema == nil {
+		return
+	}
+	columns := invalidateColumns(stmt.Schema.ModelType)
+	if columns == nil {
+		return
+	}
+
+	exprs := make([]clause.Expression, 0)
+	if where, ok := stmt.Clauses["WHERE"].Expression.(clause.Where); ok && len(where.Exprs) > 0 {
+		exprs = append(exprs, where)
+	}
+	rv := reflect.Indirect(stmt.ReflectValue)
+	if rv.Kind() == reflect.Struct {
+		for _, f := range stmt.Schema.PrimaryFields {
+			if v, zero := f.ValueOf(stmt.Context, rv); !zero {
+				exprs = append(exprs, clause.Eq{Column: clause.Column{Table: stmt.Table, Name: f.DBName}, Value: v})
+			}
+		}
+	}
+	if len(exprs) == 0 {
+		// gorm refuses an update or delete without conditions
+		return
+	}
+
+	old := reflect.New(reflect.SliceOf(reflect.PtrTo(stmt.Schema.ModelType)))
+	err := tx.Session(&gorm.Session{NewDB: true}).Table(stmt.Table).Select(columns).Clauses(exprs...).Find(old.Interface()).Error
+	if err != nil {
+		tx.Logger.Error(stmt.Context, "invalidate loaders, reload old rows: %v", err)
+		return
+	}
+	tx.InstanceSet(invalidateOldKey, old.Elem().Interface())
+}
+
+func (p *InvalidatePlugin) invalidate(tx *gorm.DB) {
+	if tx.Error != nil {
+		return
+	}
+	values := []reflect.Value{tx.Statement.ReflectValue}
+	if old, ok := tx.InstanceGet(invalidateOldKey); ok {
+		values = append(values, reflect.ValueOf(old))
+	}
+	for _, v := range values {
+		if err := invalidateValue(tx.Statement.Context, p.cache, v); err != nil {
+			// the change is committed already, a failed invalidation must not fail it
+			tx.Logger.Error(tx.Statement.Context, "invalidate loaders: %v", err)
+		}
+	}
+}
+
+// invalidateColumns returns the columns the Invalidate helper of rt reads, nil
+// when rt is not a model with Invalidate helpers
+func invalidateColumns(rt reflect.Type) []string {
+	switch reflect.New(rt).Interface().(type) {
+	{{- range .Models}}
+	case *{{$.ModelPkg}}.{{.Name}}:
+		return []string{ {{- range $i, $c := .Columns}}{{if $i}}, {{end}}{{printf "%q" $c}}{{end -}} }
+	{{- end}}
+	}
+	return nil
+}
+
+// invalidateValue walks the records of a statement, a model, a pointer or a slice of them
+func invalidateValue(ctx context.Context, cache Cache, v reflect.Value) error {
+	switch v.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			if err := invalidateValue(ctx, cache, v.Index(i)); err != nil {
+				return err
+			}
+		}
+	case reflect.Ptr, reflect.Interface:
+		if !v.IsNil() {
+			return invalidateValue(ctx, cache, v.Elem())
+		}
+	case reflect.Struct:
+		if !v.CanAddr() {
+			cpy := reflect.New(v.Type()).Elem()
+			cpy.Set(v)
+			v = cpy
+		}
+		switch rec := v.Addr().Interface().(type) {
+		{{- range .Models}}
+		case *{{$.ModelPkg}}.{{.Name}}:
+			return Invalidate{{.Name}}(ctx, cache, rec)
+		{{- end}}
+		}
+	}
+	return nil
+}
+`
@@ -0,0 +1,197 @@
+package template
+
+// LoaderCtx is the dataloaden loader with a context.Context on every call. A batch
+// is shared by its callers so it is fetched with the values of the first context
+// only, not its deadline or cancellation, and every caller stops waiting as soon
+// as its own context is done
+const LoaderCtx = `
+// {{.Name}} batches and caches requests
+type {{.Name}} struct {
+	// this method provides the data for the loader
+	fetch func(ctx context.Context, keys []{{.KeyType}}) ([]{{.ValType}}, []error)
+
+	// how long to done before sending a batch
+	wait time.Duration
+
+	// this will limit the maximum number of keys to send in one batch, 0 = no limit
+	maxBatch int
+
+	// INTERNAL
+
+	// lazily created cache
+	cache map[{{.KeyType}}]{{.ValType}}
+
+	// the current batch. keys will continue to be collected until timeout is hit,
+	// then everything will be sent to the fetch method and out to the listeners
+	batch *{{.LcName}}Batch
+
+	// mutex to prevent races
+	mu sync.Mutex
+}
+
+type {{.LcName}}Batch struct {
+	ctx     context.Context
+	keys    []{{.KeyType}}
+	data    []{{.ValType}}
+	error   []error
+	closing bool
+	done    chan struct{}
+}
+
+// Load a {{.ValType}} by key, batching and caching will be applied automatically
+func (l *{{.Name}}) Load(ctx context.Context, key {{.KeyType}}) ({{.ValType}}, error) {
+	return l.LoadThunk(ctx, key)()
+}
+
+// LoadThunk returns a function that when called will block waiting for a {{.ValType}}
+// or until ctx is done.
+func (l *{{.Name}}) LoadThunk(ctx context.Context, key {{.KeyType}}) func() ({{.ValType}}, error) {
+	l.mu.Lock()
+	if it, ok := l.cache[key]; ok {
+		l.mu.Unlock()
+		return func() ({{.ValType}}, error) {
+			return it, nil
+		}
+	}
+	if l.batch == nil {
+		l.batch = &{{.LcName}}Batch{ctx: detachedContext{ctx}, done: make(chan struct{})}
+	}
+	batch := l.batch
+	pos := batch.keyIndex(l, key)
+	l.mu.Unlock()
+
+	return func() ({{.ValType}}, error) {
+		var data {{.ValType}}
+
+		select {
+		case <-batch.done:
+		case <-ctx.Done():
+			return data, &LoadError{Kind: ErrDatabase, Op: "wait", Model: "{{.Model}}", Field: "{{.Field}}", Key: key, Err: ctx.Err()}
+		}
+
+		if pos < len(batch.data) {
+			data = batch.data[pos]
+		}
+
+		var err error
+		// its convenient to be able to return a single error for everything
+		if len(batch.error) == 1 {
+			err = batch.error[0]
+		} else if batch.error != nil {
+			err = batch.error[pos]
+		}
+
+		if err == nil {
+			l.mu.Lock()
+			l.unsafeSet(key, data)
+			l.mu.Unlock()
+		}
+
+		return data, err
+	}
+}
+
+// LoadAll fetches many keys at once. It will be broken into appropriate sized
+// sub batches depending on how the loader is configured
+func (l *{{.Name}}) LoadAll(ctx context.Context, keys []{{.KeyType}}) ([]{{.ValType}}, []error) {
+	return l.LoadAllThunk(ctx, keys)()
+}
+
+// LoadAllThunk returns a function that when called will block waiting for the {{.ValType}} values.
+func (l *{{.Name}}) LoadAllThunk(ctx context.Context, keys []{{.KeyType}}) func() ([]{{.ValType}}, []error) {
+	results := make([]func() ({{.ValType}}, error), len(keys))
+	for i, key := range keys {
+		results[i] = l.LoadThunk(ctx, key)
+	}
+	return func() ([]{{.ValType}}, []error) {
+		values := make([]{{.ValType}}, len(keys))
+		errors := make([]error, len(keys))
+		for i, thunk := range results {
+			values[i], errors[i] = thunk()
+		}
+		return values, errors
+	}
+}
+
+// Prime the cache with the provided key and value. If the key already exists, no change is made
+// and false is returned.
+func (l *{{.Name}}) Prime(key {{.KeyType}}, value {{.ValType}}) bool {
+	l.mu.Lock()
+	var found bool
+	if _, found = l.cache[key]; !found {
+		{{- if .ValIsPtr}}
+		// make a copy when writing to the cache, its easy to pass a pointer in from a loop var
+		// and end up with the whole cache pointing to the same value.
+		cpy := *value
+		l.unsafeSet(key, &cpy)
+		{{- else}}
+		cpy := make({{.ValType}}, len(value))
+		copy(cpy, value)
+		l.unsafeSet(key, cpy)
+		{{- end}}
+	}
+	l.mu.Unlock()
+	return !found
+}
+
+// Clear the value at key from the cache, if it exists
+func (l *{{.Name}}) Clear(key {{.KeyType}}) {
+	l.mu.Lock()
+	delete(l.cache, key)
+	l.mu.Unlock()
+}
+
+func (l *{{.Name}}) unsafeSet(key {{.KeyType}}, value {{.ValType}}) {
+	if l.cache == nil {
+		l.cache = map[{{.KeyType}}]{{.ValType}}{}
+	}
+	l.cache[key] = value
+}
+
+// keyIndex will return the location of the key in the batch, if its not found
+// it will add the key to the batch
+func (b *{{.LcName}}Batch) keyIndex(l *{{.Name}}, key {{.KeyType}}) int {
+	for i, existingKey := range b.keys {
+		if key == existingKey {
+			return i
+		}
+	}
+
+	pos := len(b.keys)
+	b.keys = append(b.keys, key)
+	if pos == 0 {
+		go b.startTimer(l)
+	}
+
+	if l.maxBatch != 0 && pos >= l.maxBatch-1 {
+		if !b.closing {
+			b.closing = true
+			l.batch = nil
+			go b.end(l)
+		}
+	}
+
+	return pos
+}
+
+func (b *{{.LcName}}Batch) startTimer(l *{{.Name}}) {
+	time.Sleep(l.wait)
+	l.mu.Lock()
+
+	// we must have hit a batch limit and are already finalizing this batch
+	if b.closing {
+		l.mu.Unlock()
+		return
+	}
+
+	l.batch = nil
+	l.mu.Unlock()
+
+	b.end(l)
+}
+
+func (b *{{.LcName}}Batch) end(l *{{.Name}}) {
+	b.data, b.error = l.fetch(b.ctx, b.keys)
+	close(b.done)
+}
+`
@@ -0,0 +1,25 @@
+package template
+
+// Relation follows a foreign key from a loaded record through the loader of the
+// other side, the loaders are the ones set by SetDefault and ErrLoaderNotSet is
+// returned before
+const Relation = `
+// Load{{.Name}}For{{.ModelStructName}} loads the {{.Name}} of rec through {{.Loader}}
+func Load{{.Name}}For{{.ModelStructName}}({{if .UseContext}}ctx context.Context, {{end}}rec *{{.ModelPkg}}.{{.ModelStructName}}) ({{.ValType}}, error) {
+	if rec == nil {
+		return nil, nil
+	}
+	{{- range .Keys}}
+	{{- if .Asterisk}}
+	if rec.{{.Field}} == nil {
+		return nil, nil
+	}
+	{{- end}}
+	{{- end}}
+	if {{.Loader}} == nil {
+		return nil, fmt.Errorf("{{.Loader}}: %w", ErrLoaderNotSet)
+	}
+
+	return {{.Loader}}.Load({{if .UseContext}}ctx, {{end}}{{.Key}})
+}
+`
@@ -0,0 +1,114 @@
+package dataloader
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+
+	tpl "github.com/soedomoto/db2gorm/module/dataloader/template"
+)
+
+// templateExt is the extension of the template files of a templates_dir
+const templateExt = ".tmpl"
+
+// Templates are the template sources by name, the defaults of the template
+// package overridden by the <name>.tmpl files of a templates_dir
+type Templates struct {
+	sources map[string]string
+	files   map[string]string // name -> override file
+}
+
+// TemplateNames returns the names of the templates that can be overridden
+func TemplateNames() []string {
+	names := make([]string, 0, len(tpl.Templates))
+	for name := range tpl.Templates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// LoadTemplates reads the overrides of dir, blank dir means the defaults only. Every
+// override is parsed so errors are reported with their file and line
+func LoadTemplates(dir string) (*Templates, error) {
+	t := &Templates{sources: make(map[string]string, len(tpl.Templates)), files: map[string]string{}}
+	for name, src := range tpl.Templates {
+		t.sources[name] = src
+	}
+	if dir == "" {
+		return t, nil
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*"+templateExt))
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		name := strings.TrimSuffix(filepath.Base(file), templateExt)
+		if _, ok := tpl.Templates[name]; !ok {
+			return nil, fmt.Errorf("%s: unknown template %q (support %s for now)", file, name, strings.Join(TemplateNames(), " || "))
+		}
+
+		content, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := newTemplate(file).Parse(string(content)); err != nil {
+			return nil, err
+		}
+		t.sources[name], t.files[name] = string(content), file
+	}
+	return t, nil
+}
+
+// newTemplate returns a template named name, a missing key of the data is an
+// error so a typo in an override reports its file and line
+func newTemplate(name string) *template.Template {
+	return template.New(name).Funcs(funcMap).Option("missingkey=error")
+}
+
+// render executes the template called name, text/template is used because the
+// output is Go source and must not be escaped
+func (t *Templates) render(name string, wr io.Writer, data interface{}) error {
+	src, ok := t.sources[name]
+	if !ok {
+		return fmt.Errorf("unknown template %q", name)
+	}
+
+	// an override is named after its file so errors point at it
+	file := name
+	if f, ok := t.files[name]; ok {
+		file = f
+	}
+
+	tmpl, err := newTemplate(file).Parse(src)
+	if err != nil {
+		return err
+	}
+	return tmpl.Execute(wr, data)
+}
+
+// ExportTemplates writes the default templates to dir as <name>.tmpl, existing
+// files are kept. It returns the files written
+func ExportTemplates(dir string) ([]string, error) {
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return nil, err
+	}
+
+	written := make([]string, 0, len(tpl.Templates))
+	for _, name := range TemplateNames() {
+		file := filepath.Join(dir, name+templateExt)
+		if _, err := os.Stat(file); err == nil {
+			continue
+		}
+		if err := os.WriteFile(file, []byte(strings.TrimLeft(tpl.Templates[name], "\n")), 0640); err != nil {
+			return written, err
+		}
+		written = append(written, file)
+	}
+	return written, nil
+}
@@ -0,0 +1,215 @@
+package dataloader
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/soedomoto/db2gorm/module/schema"
+	"github.com/soedomoto/db2gorm/properties"
+	"gorm.io/gen/field"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files of testdata/golden")
+
+// goldenSchema holds the hard cases of the templates: reserved words, quoted
+// column and index names, pointer and generic field types, composite keys with
+// a nullable column and relations both ways
+func goldenSchema() *schema.Schema {
+	column := func(name, typ, column string, gormTag field.GormTag) *schema.Field {
+		gormTag["column"] = column
+		return &schema.Field{Name: name, Type: typ, ColumnName: column, Tag: field.Tag{"json": column}, GORMTag: gormTag}
+	}
+
+	order := &schema.Table{
+		Name:            "order",
+		ModelStructName: "Order",
+		Fields: []*schema.Field{
+			column("ID", "int64", "id", field.GormTag{"primaryKey": ""}),
+			column("Select_", "string", "select", field.GormTag{"uniqueIndex": `uq_order_"select",priority:1`}),
+			column("Type", "*string", "type", field.GormTag{}),
+			column("Meta", "datatypes.JSONType[string]", "meta", field.GormTag{"type": "json"}),
+			{Name: "Items", Type: "[]*OrderItem", Tag: field.Tag{"json": "items"}, Relation: &field.Relation{}},
+		},
+		Indexes: []schema.Index{
+			{Name: "order_pkey", Columns: []string{"id"}, PrimaryKey: true, Unique: true},
+			{Name: `uq_order_"select"`, Columns: []string{"select"}, Unique: true},
+		},
+	}
+	item := &schema.Table{
+		Name:            "order_item",
+		ModelStructName: "OrderItem",
+		Fields: []*schema.Field{
+			column("OrderID", "int64", "order_id", field.GormTag{"primaryKey": ""}),
+			column("Line", "int32", "line", field.GormTag{"primaryKey": ""}),
+			column("ItemNote", "*string", `item "note"`, field.GormTag{}),
+			{Name: "Order", Type: "*Order", Tag: field.Tag{"json": "order"}, Relation: &field.Relation{}},
+		},
+		Indexes: []schema.Index{
+			{Name: "order_item_pkey", Columns: []string{"order_id", "line"}, PrimaryKey: true, Unique: true},
+			{Name: `uq_order_item_"note"`, Columns: []string{"order_id", `item "note"`}, Unique: true},
+		},
+		ForeignKeys: []schema.ForeignKey{
+			{Name: "fk_order_item_order", Columns: []string{"order_id"}, RefTable: "order"},
+		},
+	}
+
+	return &schema.Schema{
+		Tables: []*schema.Table{order, item},
+		Relations: []schema.Relation{
+			{Table: "order_item", Target: "order", Type: field.BelongsTo, Name: "Order", ForeignKey: []string{"OrderID"}, References: []string{"ID"}, ToPrimary: true},
+			{Table: "order", Target: "order_item", Type: field.HasMany, Name: "Items", ForeignKey: []string{"OrderID"}, References: []string{"ID"}, ToPrimary: true},
+		},
+	}
+}
+
+func goldenGenerator(dir string) *Generator {
+	return NewGenerator(Config{
+		OutPath:      dir,
+		Package:      "dataloader",
+		ModelPackage: "example.com/golden/model",
+		OrmPackage:   "example.com/golden/orm",
+		MaxParams:    999,
+	})
+}
+
+// generateGolden runs every generation step of d on the golden schema into dir
+func generateGolden(t *testing.T, d *properties.Databases, dir string) {
+	t.Helper()
+
+	g := goldenGenerator(dir)
+	s := goldenSchema()
+	structFields := make([][]string, 0)
+	for _, m := range s.Tables {
+		sfs, err := g.GenerateDataloader(d, m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		structFields = append(structFields, sfs...)
+	}
+	if err := g.GenerateRelations(d, s.Relations); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.GenerateInvalidate(d); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.GenerateDataloaderAgg(d, structFields); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readDir(t *testing.T, dir string) []string {
+	t.Helper()
+
+	entries, err := os.ReadDir(dir)
+	if err != nil && !os.IsNotExist(err) {
+		t.Fatal(err)
+	}
+	names := make([]string, 0, len(entries))
+	for _, e := range entries {
+		names = append(names, strings.TrimSuffix(e.Name(), ".golden"))
+	}
+	sort.Strings(names)
+	return names
+}
+
+// TestGolden renders every template for each combination of dataloader_context,
+// dataloader_cache with dataloader_use_redis and dataloader_not_found_error, go
+// test -update rewrites testdata/golden after a template change
+func TestGolden(t *testing.T) {
+	// the loaders without context come from dataloaden, not from the templates
+	defer func(generate func(string, string, string, string) error) { dataloaden = generate }(dataloaden)
+	dataloaden = func(name, keyType, valueType, wd string) error { return nil }
+
+	for _, useContext := range []bool{false, true} {
+		for _, useRedis := range []bool{false, true} {
+			for _, notFound := range []bool{false, true} {
+				parts := []string{}
+				for _, p := range []struct {
+					on   bool
+					name string
+				}{{useContext, "context"}, {useRedis, "redis"}, {notFound, "notfound"}} {
+					if p.on {
+						parts = append(parts, p.name)
+					}
+				}
+				name := strings.Join(parts, "_")
+				if name == "" {
+					name = "plain"
+				}
+
+				t.Run(name, func(t *testing.T) {
+					d := &properties.Databases{
+						Name:                    "Golden",
+						DataloaderContext:       useContext,
+						DataloaderCache:         useRedis,
+						DataloaderUseRedis:      useRedis,
+						DataloaderNotFoundError: notFound,
+						DataloaderCachePrefix:   "app",
+						DataloaderOptions:       properties.DataloaderOptions{NegativeCacheTTL: time.Minute},
+						DataloaderFields:        map[string]*properties.DataloaderFields{"order": {Include: []string{"type", "meta"}}},
+					}
+					out := t.TempDir()
+					generateGolden(t, d, out)
+
+					golden := filepath.Join("testdata", "golden", name)
+					if *update {
+						if err := os.RemoveAll(golden); err != nil {
+							t.Fatal(err)
+						}
+						if err := os.MkdirAll(golden, 0o755); err != nil {
+							t.Fatal(err)
+						}
+					}
+
+					files := readDir(t, out)
+					if want := readDir(t, golden); !*update && strings.Join(files, ",") != strings.Join(want, ",") {
+						t.Fatalf("got files %v, want %v", files, want)
+					}
+					for _, file := range files {
+						got, err := os.ReadFile(filepath.Join(out, file))
+						if err != nil {
+							t.Fatal(err)
+						}
+						if *update {
+							if err := os.WriteFile(filepath.Join(golden, file+".golden"), got, 0o644); err != nil {
+								t.Fatal(err)
+							}
+							continue
+						}
+
+						want, err := os.ReadFile(filepath.Join(golden, file+".golden"))
+						if err != nil {
+							t.Fatal(err)
+						}
+						if string(got) != string(want) {
+							t.Errorf("%s differs from %s, run go test -update after a template change:\n%s", file, golden, got)
+						}
+					}
+				})
+			}
+		}
+	}
+}
+
+func TestTemplateOverrideMissingKey(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "Cache"+templateExt)
+	if err := os.WriteFile(file, []byte("// cache\n{{if .UseRedys}}{{end}}\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tmpl, err := LoadTemplates(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf strings.Builder
+	err = tmpl.render("Cache", &buf, map[string]interface{}{"UseRedis": true})
+	if err == nil || !strings.Contains(err.Error(), file+":2:") || !strings.Contains(err.Error(), "UseRedys") {
+		t.Errorf("got %v, want an error at %s:2", err, file)
+	}
+}
@@ -0,0 +1,87 @@
+package generror
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Error is a generation failure with the database, table and field it happened in
+type Error struct {
+	Database string
+	Table    string
+	Field    string
+	Err      error
+}
+
+func (e *Error) Error() string {
+	scope := make([]string, 0, 3)
+	for _, s := range []string{e.Database, e.Table, e.Field} {
+		if s != "" {
+			scope = append(scope, s)
+		}
+	}
+	if len(scope) == 0 {
+		return e.Err.Error()
+	}
+	return fmt.Sprintf("%s: %s", strings.Join(scope, "."), e.Err.Error())
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// List collects every failure of a generation run instead of stopping at the first one
+type List []*Error
+
+// Add appends err with its context, nested Error and List values keep their own
+// context and only get the missing parts filled in
+func (l *List) Add(database, table, field string, err error) {
+	if err == nil {
+		return
+	}
+
+	switch e := err.(type) {
+	case List:
+		for _, item := range e {
+			l.Add(database, table, field, item)
+		}
+	case *Error:
+		item := *e
+		if item.Database == "" {
+			item.Database = database
+		}
+		if item.Table == "" {
+			item.Table = table
+		}
+		if item.Field == "" {
+			item.Field = field
+		}
+		*l = append(*l, &item)
+	default:
+		*l = append(*l, &Error{Database: database, Table: table, Field: field, Err: err})
+	}
+}
+
+func (l List) Error() string {
+	lines := make([]string, 0, len(l))
+	for _, e := range l {
+		lines = append(lines, e.Error())
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (l List) Unwrap() []error {
+	errs := make([]error, 0, len(l))
+	for _, e := range l {
+		errs = append(errs, e)
+	}
+	return errs
+}
+
+// Err returns nil when nothing failed, so callers can return it directly
+func (l List) Err() error {
+	if len(l) == 0 {
+		return nil
+	}
+	return l
+}
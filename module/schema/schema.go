@@ -0,0 +1,80 @@
+package schema
+
+import (
+	"strings"
+
+	"gorm.io/gen/field"
+)
+
+// Schema is a database the way db2gorm generates it, built once from the gen models
+// and the introspection, the model and dataloader generators both read it
+type Schema struct {
+	Tables    []*Table
+	Relations []Relation
+}
+
+// Table returns the table named name, nil when it is not generated
+func (s *Schema) Table(name string) *Table {
+	for _, t := range s.Tables {
+		if t.Name == name {
+			return t
+		}
+	}
+	return nil
+}
+
+// Table is a generated model
+type Table struct {
+	Name            string // table name in db server
+	ModelStructName string
+	Fields          []*Field
+	Indexes         []Index // empty when the dialect cannot list them
+	ForeignKeys     []ForeignKey
+}
+
+// Field is a model field, relation fields have a Relation and no column
+type Field struct {
+	Name          string
+	Type          string // Go type, *T for nullable columns
+	ColumnName    string
+	ColumnComment string
+	Tag           field.Tag
+	GORMTag       field.GormTag
+	Relation      *field.Relation
+}
+
+// Index is a table index as reported by the migrator
+type Index struct {
+	Name       string
+	Columns    []string
+	PrimaryKey bool
+	Unique     bool
+}
+
+// ForeignKey is a foreign key constraint of a table
+type ForeignKey struct {
+	Name       string
+	Columns    []string
+	RefTable   string
+	RefColumns []string // empty when referencing the primary key
+}
+
+// Relation is a relation field derived from a foreign key, seen from Table
+type Relation struct {
+	Table      string // table getting the field
+	Target     string // table of the field type
+	Type       field.RelationshipType
+	Name       string
+	ForeignKey []string // field names of the foreign key columns
+	References []string // field names of the referenced columns
+	ToPrimary  bool     // References is the primary key
+}
+
+// GORMTag returns the foreignKey/references gorm tag of r
+func (r Relation) GORMTag() field.GormTag {
+	tag := field.GormTag{"foreignKey": strings.Join(r.ForeignKey, ",")}
+	if !r.ToPrimary {
+		tag["references"] = strings.Join(r.References, ",")
+	}
+	return tag
+}
@@ -2,21 +2,186 @@ package properties
 
 import (
 	"context"
+	"fmt"
 	"log"
+	"strings"
+	"time"
 
 	"gorm.io/gorm"
 )
 
+// GenConfig mirrors gorm.io/gen Config, unset values keep the db2gorm defaults
+type GenConfig struct {
+	Mode              []string `yaml:"mode"`                 // default_query || without_context || query_interface, default all
+	OutFile           string   `yaml:"out_file"`             // query code file name, default gen.go
+	ModelPkgPath      string   `yaml:"model_pkg_path"`       // model package name next to orm, default model
+	WithUnitTest      *bool    `yaml:"with_unit_test"`       // default false
+	FieldNullable     *bool    `yaml:"field_nullable"`       // pointer for nullable fields, default true
+	FieldCoverable    *bool    `yaml:"field_coverable"`      // pointer for fields with default value, default false
+	FieldSignable     *bool    `yaml:"field_signable"`       // detect unsigned integers, default false
+	FieldWithIndexTag *bool    `yaml:"field_with_index_tag"` // default true
+	FieldWithTypeTag  *bool    `yaml:"field_with_type_tag"`  // default true
+	WithRelations     *bool    `yaml:"with_relations"`       // relation fields from the foreign keys, default true
+}
+
+// ModelPkg returns the generated model package name
+func (c GenConfig) ModelPkg() string {
+	if c.ModelPkgPath == "" {
+		return "model"
+	}
+	return c.ModelPkgPath
+}
+
+// DataloaderOptions tunes the generated loaders, zero values fall back to the
+// database options and then to the defaults
+type DataloaderOptions struct {
+	Wait        time.Duration `yaml:"wait"`        // batch window, default 2ms
+	MaxBatch    int           `yaml:"max_batch"`   // default 100
+	CacheTTL    time.Duration `yaml:"cache_ttl"`   // redis entry lifetime, default 30s
+	ChunkSize   int           `yaml:"chunk_size"`  // keys per IN query, default and maximum the parameter limit of the dialect
+	Concurrency int           `yaml:"concurrency"` // IN queries running at once, default 1
+	// NegativeCacheTTL caches the keys without record of the single record loaders, default 0 = never,
+	// a negative value turns it off for a table when the database turns it on
+	NegativeCacheTTL time.Duration `yaml:"negative_cache_ttl"`
+}
+
+var DefaultDataloaderOptions = DataloaderOptions{
+	Wait:        2 * time.Millisecond,
+	MaxBatch:    100,
+	CacheTTL:    30 * time.Second,
+	Concurrency: 1,
+}
+
+// Merge returns o with its zero values taken from fallback
+func (o DataloaderOptions) Merge(fallback DataloaderOptions) DataloaderOptions {
+	if o.Wait == 0 {
+		o.Wait = fallback.Wait
+	}
+	if o.MaxBatch == 0 {
+		o.MaxBatch = fallback.MaxBatch
+	}
+	if o.CacheTTL == 0 {
+		o.CacheTTL = fallback.CacheTTL
+	}
+	if o.ChunkSize == 0 {
+		o.ChunkSize = fallback.ChunkSize
+	}
+	if o.Concurrency == 0 {
+		o.Concurrency = fallback.Concurrency
+	}
+	if o.NegativeCacheTTL == 0 {
+		o.NegativeCacheTTL = fallback.NegativeCacheTTL
+	}
+	return o
+}
+
+// Validate rejects the negative options, zero means unset
+func (o DataloaderOptions) Validate() error {
+	switch {
+	case o.Wait < 0:
+		return fmt.Errorf("wait %s cannot be negative", o.Wait)
+	case o.MaxBatch < 0:
+		return fmt.Errorf("max_batch %d cannot be negative", o.MaxBatch)
+	case o.CacheTTL < 0:
+		return fmt.Errorf("cache_ttl %s cannot be negative", o.CacheTTL)
+	case o.ChunkSize < 0:
+		return fmt.Errorf("chunk_size %d cannot be negative", o.ChunkSize)
+	case o.Concurrency < 0:
+		return fmt.Errorf("concurrency %d cannot be negative", o.Concurrency)
+	}
+	return nil
+}
+
+// DataloaderTable holds the per table dataloader settings
+type DataloaderTable struct {
+	DataloaderOptions `yaml:",inline"`
+}
+
+// Relation overrides the relation fields generated from a foreign key
+type Relation struct {
+	Table       string `yaml:"table"`        // table holding the foreign key
+	ForeignKey  string `yaml:"foreign_key"`  // constraint name, or its columns comma separated
+	Name        string `yaml:"name"`         // belongs to field, default the referenced model name
+	ReverseName string `yaml:"reverse_name"` // has one/has many field on the referenced model, default the model name (+s)
+	Skip        bool   `yaml:"skip"`         // no belongs to field
+	SkipReverse bool   `yaml:"skip_reverse"` // no has one/has many field
+}
+
+// DataloaderFields picks the columns of a table getting a loader, by default the
+// primary key, unique and foreign key columns
+type DataloaderFields struct {
+	Include []string `yaml:"include"` // more columns, "*" for all of them
+	Exclude []string `yaml:"exclude"` // wins over include and the defaults
+}
+
+// Selects reports whether column gets a loader, byDefault when it is not listed
+func (f DataloaderFields) Selects(column string, byDefault bool) bool {
+	for _, c := range f.Exclude {
+		if c == column {
+			return false
+		}
+	}
+	for _, c := range f.Include {
+		if c == "*" || c == column {
+			return true
+		}
+	}
+	return byDefault
+}
+
 type Databases struct {
-	Name               string `yaml:"name"`
-	DSN                string `yaml:"dsn"` // consult[https://gorm.io/docs/connecting_to_the_database.html]"
-	StrTables          string `yaml:"tables"`
-	ModuleName         string `yaml:"module_name"`
-	OutPath            string `yaml:"out_path"`
-	Dataloader         bool   `yaml:"dataloader"`
-	DataloaderPkOnly   bool   `yaml:"dataloader_pk_only"`
-	DataloaderUseRedis bool   `yaml:"dataloader_use_redis"`
-	Db                 *gorm.DB
+	Name                    string                       `yaml:"name"`
+	DSN                     string                       `yaml:"dsn"`      // consult[https://gorm.io/docs/connecting_to_the_database.html]"
+	DSNFile                 string                       `yaml:"dsn_file"` // read the dsn from this file instead, e.g. a mounted secret
+	Snapshot                string                       `yaml:"snapshot"` // schema file written by `db2gorm snapshot`, generate offline when set
+	StrTables               string                       `yaml:"tables"`
+	Include                 []string                     `yaml:"include"`    // glob (tmp_*) or /regex/ patterns, blank means ALL
+	Exclude                 []string                     `yaml:"exclude"`    // glob (tmp_*) or /regex/ patterns
+	SkipViews               bool                         `yaml:"skip_views"` // skip views, needs table type support of the dialect
+	ModuleName              string                       `yaml:"module_name"`
+	OutPath                 string                       `yaml:"out_path"`
+	Dataloader              bool                         `yaml:"dataloader"`
+	DataloaderPkOnly        bool                         `yaml:"dataloader_pk_only"`
+	DataloaderContext       bool                         `yaml:"dataloader_context"`         // Load/LoadAll take a context.Context
+	DataloaderCache         bool                         `yaml:"dataloader_cache"`           // loaders read and fill their Cache argument
+	DataloaderUseRedis      bool                         `yaml:"dataloader_use_redis"`       // generate RedisCache, needs dataloader_cache
+	DataloaderNotFoundError bool                         `yaml:"dataloader_not_found_error"` // single record loaders return a NotFoundError for a key without record
+	DataloaderCachePrefix   string                       `yaml:"dataloader_cache_prefix"`    // prepended to the cache keys, before the database name
+	DataloaderOptions       DataloaderOptions            `yaml:"dataloader_options"`
+	DataloaderTables        map[string]*DataloaderTable  `yaml:"dataloader_tables"` // keyed by table name
+	DataloaderFields        map[string]*DataloaderFields `yaml:"dataloader_fields"` // keyed by table name
+	Relations               []*Relation                  `yaml:"relations"`
+	TemplatesDir            string                       `yaml:"templates_dir"` // <name>.tmpl files overriding the dataloader templates
+	Gen                     GenConfig                    `yaml:"gen"`
+	Db                      *gorm.DB
+}
+
+// TableNames returns the tables listed in `tables`, empty means ALL
+func (db *Databases) TableNames() []string {
+	tables := make([]string, 0)
+	if strTables := strings.Trim(db.StrTables, " "); strTables != "" {
+		for _, t := range strings.Split(strTables, ",") {
+			tables = append(tables, strings.Trim(t, " "))
+		}
+	}
+	return tables
+}
+
+// DataloaderOptionsOf returns the dataloader options of a table
+func (db *Databases) DataloaderOptionsOf(tableName string) DataloaderOptions {
+	o := db.DataloaderOptions.Merge(DefaultDataloaderOptions)
+	if t, ok := db.DataloaderTables[tableName]; ok && t != nil {
+		o = t.DataloaderOptions.Merge(o)
+	}
+	return o
+}
+
+// DataloaderFieldsOf returns the dataloader column selection of a table
+func (db *Databases) DataloaderFieldsOf(tableName string) DataloaderFields {
+	if f, ok := db.DataloaderFields[tableName]; ok && f != nil {
+		return *f
+	}
+	return DataloaderFields{}
 }
 
 func (db *Databases) info(logInfos ...string) {
@@ -0,0 +1,164 @@
+package v2
+
+import (
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/soedomoto/db2gorm/module/schema"
+	"github.com/soedomoto/db2gorm/properties"
+	"gorm.io/gen/field"
+)
+
+// relationTable is what the relations need to know of a generated model
+type relationTable struct {
+	Struct  string
+	Fields  map[string]string // column -> field name
+	Primary []string
+	Unique  map[string][]string // index name -> columns
+}
+
+// relationTableOf reads the column fields of t, the primary key and unique indexes
+// come from their gen tags
+func relationTableOf(t *schema.Table) *relationTable {
+	rt := &relationTable{Struct: t.ModelStructName, Fields: map[string]string{}, Unique: map[string][]string{}}
+	for _, f := range t.Fields {
+		if f.ColumnName == "" {
+			continue
+		}
+
+		rt.Fields[f.ColumnName] = f.Name
+		if _, ok := f.GORMTag["primaryKey"]; ok {
+			rt.Primary = append(rt.Primary, f.ColumnName)
+		}
+		if idx, ok := f.GORMTag["uniqueIndex"]; ok {
+			name := strings.Split(idx, ",")[0]
+			rt.Unique[name] = append(rt.Unique[name], f.ColumnName)
+		}
+	}
+	return rt
+}
+
+func sameColumns(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	set := make(map[string]bool, len(a))
+	for _, c := range a {
+		set[c] = true
+	}
+	for _, c := range b {
+		if !set[c] {
+			return false
+		}
+	}
+	return true
+}
+
+func fieldNames(t *relationTable, columns []string) ([]string, bool) {
+	names := make([]string, 0, len(columns))
+	for _, c := range columns {
+		name, ok := t.Fields[c]
+		if !ok {
+			return nil, false
+		}
+		names = append(names, name)
+	}
+	return names, true
+}
+
+// relationOverride returns the relations entry of the foreign key, matched by
+// constraint name or by its columns
+func relationOverride(d *properties.Databases, table string, fk schema.ForeignKey) properties.Relation {
+	for _, r := range d.Relations {
+		if r != nil && r.Table == table && (r.ForeignKey == fk.Name || r.ForeignKey == strings.Join(fk.Columns, ",")) {
+			return *r
+		}
+	}
+	return properties.Relation{}
+}
+
+// Relations turns the foreign keys between the tables of s into belongs to fields
+// on the referencing model and has one/has many fields on the referenced one,
+// foreign keys to tables outside of s are ignored
+func Relations(d *properties.Databases, s *schema.Schema) []schema.Relation {
+	tables := make(map[string]*relationTable, len(s.Tables))
+	foreignKeys := make(map[string][]schema.ForeignKey, len(s.Tables))
+	names := make([]string, 0, len(s.Tables))
+	for _, t := range s.Tables {
+		tables[t.Name] = relationTableOf(t)
+		foreignKeys[t.Name] = t.ForeignKeys
+		names = append(names, t.Name)
+	}
+	sort.Strings(names)
+
+	taken := make(map[string]map[string]bool, len(tables))
+	for name, table := range tables {
+		taken[name] = make(map[string]bool, len(table.Fields))
+		for _, f := range table.Fields {
+			taken[name][f] = true
+		}
+	}
+	add := func(relations []schema.Relation, r schema.Relation) []schema.Relation {
+		if taken[r.Table][r.Name] {
+			r.Name += "By" + strings.Join(r.ForeignKey, "")
+		}
+		if taken[r.Table][r.Name] {
+			log.Printf("relation %s.%s skipped, the field name is already used", r.Table, r.Name)
+			return relations
+		}
+		taken[r.Table][r.Name] = true
+		return append(relations, r)
+	}
+
+	relations := make([]schema.Relation, 0)
+	for _, name := range names {
+		child := tables[name]
+		for _, fk := range foreignKeys[name] {
+			parent, ok := tables[fk.RefTable]
+			if !ok {
+				continue
+			}
+			foreignKey, ok := fieldNames(child, fk.Columns)
+			if !ok {
+				continue
+			}
+			refColumns := fk.RefColumns
+			if len(refColumns) == 0 {
+				refColumns = parent.Primary
+			}
+			references, ok := fieldNames(parent, refColumns)
+			if !ok {
+				continue
+			}
+			toPrimary := sameColumns(refColumns, parent.Primary)
+
+			o := relationOverride(d, name, fk)
+			if !o.Skip {
+				r := schema.Relation{Table: name, Target: fk.RefTable, Type: field.BelongsTo, Name: parent.Struct, ForeignKey: foreignKey, References: references, ToPrimary: toPrimary}
+				if o.Name != "" {
+					r.Name = o.Name
+				}
+				relations = add(relations, r)
+			}
+
+			if !o.SkipReverse {
+				r := schema.Relation{Table: fk.RefTable, Target: name, Type: field.HasMany, Name: child.Struct + "s", ForeignKey: foreignKey, References: references, ToPrimary: toPrimary}
+				if sameColumns(fk.Columns, child.Primary) {
+					r.Type, r.Name = field.HasOne, child.Struct
+				}
+				for _, u := range child.Unique {
+					if sameColumns(fk.Columns, u) {
+						r.Type, r.Name = field.HasOne, child.Struct
+					}
+				}
+				if o.ReverseName != "" {
+					r.Name = o.ReverseName
+				}
+				relations = add(relations, r)
+			}
+		}
+	}
+
+	return relations
+}
@@ -0,0 +1,145 @@
+package v2
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/soedomoto/db2gorm/properties"
+)
+
+// fixtureDatabase loads testdata/db2gorm.yml, generating into a temporary out_path
+// from the testdata/schema.yml snapshot
+func fixtureDatabase(t *testing.T) (*generator, *properties.Databases) {
+	t.Helper()
+
+	g, err := NewGeneratorFromFile("testdata/db2gorm.yml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := g.ConnectDb(); err != nil {
+		t.Fatal(err)
+	}
+
+	d := g.config.Databases[0]
+	d.OutPath = t.TempDir()
+	return g, d
+}
+
+func TestBuildSchemaFields(t *testing.T) {
+	g, d := fixtureDatabase(t)
+	s, err := g.BuildSchema(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// column -> field name and Go type, relation fields have no column
+	want := map[string]map[string]string{
+		"datapokok": {
+			"id":    "ID int32",
+			"nip":   "Nip string",
+			"alias": "Alias_ string",
+			"":      "Datapendidikans []*Datapendidikan",
+		},
+		"datapendidikan": {
+			"datapokok_id": "DatapokokID int32",
+			"":             "Datapokok *Datapokok",
+		},
+		"riwayat": {
+			"urut":    "Urut int32",
+			"jabatan": "Jabatan *string",
+		},
+	}
+	for table, columns := range want {
+		st := s.Table(table)
+		if st == nil {
+			t.Fatalf("table %s missing from the schema", table)
+		}
+		got := make(map[string]string)
+		for _, f := range st.Fields {
+			got[f.ColumnName] = f.Name + " " + f.Type
+		}
+		for column, field := range columns {
+			if got[column] != field {
+				t.Errorf("%s.%s: got field %q, want %q", table, column, got[column], field)
+			}
+		}
+	}
+
+	if n := len(s.Table("riwayat").Indexes); n != 2 {
+		t.Errorf("riwayat: got %d indexes, want 2", n)
+	}
+	if n := len(s.Relations); n != 2 {
+		t.Errorf("got %d relations, want 2", n)
+	}
+}
+
+func TestGenerateModelFromSchema(t *testing.T) {
+	g, d := fixtureDatabase(t)
+	s, err := g.BuildSchema(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the model follows the schema, not the database
+	for _, f := range s.Table("datapokok").Fields {
+		if f.ColumnName == "nama" {
+			f.Type = "*string"
+		}
+	}
+	if err := g.GenerateModel(d, s); err != nil {
+		t.Fatal(err)
+	}
+	code, err := os.ReadFile(filepath.Join(d.OutPath, "model", "datapokok.gen.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(code), "Nama            *string") {
+		t.Errorf("datapokok model does not use the schema type of nama:\n%s", code)
+	}
+}
+
+func TestGenerateModelSchemaMismatch(t *testing.T) {
+	g, d := fixtureDatabase(t)
+	s, err := g.BuildSchema(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// gen cannot rename a field, a schema it cannot follow must not generate silently
+	s.Table("riwayat").Fields[1].Name = "Sequence"
+	err = g.GenerateModel(d, s)
+	if err == nil || !strings.Contains(err.Error(), "does not match the schema field Sequence") {
+		t.Fatalf("got %v, want a schema mismatch", err)
+	}
+}
+
+func TestDataloaderKeysFromSchema(t *testing.T) {
+	g, d := fixtureDatabase(t)
+	s, err := g.BuildSchema(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := g.GenerateDataloader(d, s); err != nil {
+		t.Fatal(err)
+	}
+
+	// primary keys, unique indexes and foreign keys get a loader, composite keys
+	// are named after their fields
+	for _, file := range []string{
+		"datapokok_idloader_gen.go",
+		"datapokok_niploader_gen.go",
+		"datapendidikan_idloader_gen.go",
+		"datapendidikan_datapokokidloader_gen.go",
+		"riwayat_datapokokidurutloader_gen.go",
+		"riwayat_datapokokidjabatanloader_gen.go",
+	} {
+		if _, err := os.Stat(filepath.Join(d.OutPath, "dataloader", file)); err != nil {
+			t.Errorf("loader %s not generated: %v", file, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(d.OutPath, "dataloader", "datapokok_namaloader_gen.go")); err == nil {
+		t.Errorf("loader of the plain column nama generated")
+	}
+}
@@ -0,0 +1,446 @@
+package v2
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	gormmigrator "gorm.io/gorm/migrator"
+	"gorm.io/gorm/schema"
+)
+
+// SnapshotVersion is the version of the snapshot file format written by db2gorm
+const SnapshotVersion = "1"
+
+// Snapshot is a point-in-time dump of a database schema, enough to generate models
+// and dataloaders without a live connection
+type Snapshot struct {
+	Version  string           `json:"version" yaml:"version"`
+	Dialect  string           `json:"dialect" yaml:"dialect"`
+	Database string           `json:"database,omitempty" yaml:"database,omitempty"`
+	Tables   []*SnapshotTable `json:"tables" yaml:"tables"`
+}
+
+type SnapshotTable struct {
+	Name        string            `json:"name" yaml:"name"`
+	Type        string            `json:"type,omitempty" yaml:"type,omitempty"`
+	Comment     *string           `json:"comment,omitempty" yaml:"comment,omitempty"`
+	Columns     []*SnapshotColumn `json:"columns" yaml:"columns"`
+	Indexes     []*SnapshotIndex  `json:"indexes,omitempty" yaml:"indexes,omitempty"`
+	ForeignKeys []*ForeignKey     `json:"foreign_keys,omitempty" yaml:"foreign_keys,omitempty"`
+}
+
+type SnapshotColumn struct {
+	Name          string  `json:"name" yaml:"name"`
+	DatabaseType  string  `json:"database_type" yaml:"database_type"`
+	ColumnType    *string `json:"column_type,omitempty" yaml:"column_type,omitempty"`
+	ScanType      string  `json:"scan_type,omitempty" yaml:"scan_type,omitempty"`
+	PrimaryKey    *bool   `json:"primary_key,omitempty" yaml:"primary_key,omitempty"`
+	AutoIncrement *bool   `json:"auto_increment,omitempty" yaml:"auto_increment,omitempty"`
+	Unique        *bool   `json:"unique,omitempty" yaml:"unique,omitempty"`
+	Nullable      *bool   `json:"nullable,omitempty" yaml:"nullable,omitempty"`
+	Length        *int64  `json:"length,omitempty" yaml:"length,omitempty"`
+	Precision     *int64  `json:"precision,omitempty" yaml:"precision,omitempty"`
+	Scale         *int64  `json:"scale,omitempty" yaml:"scale,omitempty"`
+	Default       *string `json:"default,omitempty" yaml:"default,omitempty"`
+	Comment       *string `json:"comment,omitempty" yaml:"comment,omitempty"`
+}
+
+type SnapshotIndex struct {
+	Name       string   `json:"name" yaml:"name"`
+	Columns    []string `json:"columns" yaml:"columns"`
+	PrimaryKey *bool    `json:"primary_key,omitempty" yaml:"primary_key,omitempty"`
+	Unique     *bool    `json:"unique,omitempty" yaml:"unique,omitempty"`
+	Option     string   `json:"option,omitempty" yaml:"option,omitempty"`
+}
+
+func optBool(v bool, ok bool) *bool {
+	if !ok {
+		return nil
+	}
+	return &v
+}
+
+func optInt64(v int64, ok bool) *int64 {
+	if !ok {
+		return nil
+	}
+	return &v
+}
+
+func optString(v string, ok bool) *string {
+	if !ok {
+		return nil
+	}
+	return &v
+}
+
+func nullBool(v *bool) sql.NullBool {
+	if v == nil {
+		return sql.NullBool{}
+	}
+	return sql.NullBool{Bool: *v, Valid: true}
+}
+
+func nullString(v *string) sql.NullString {
+	if v == nil {
+		return sql.NullString{}
+	}
+	return sql.NullString{String: *v, Valid: true}
+}
+
+// =================================================================================
+
+// Snapshot introspects every table in tables, see FilterTables
+func (t *migrator) Snapshot(tables []string) (*Snapshot, error) {
+	s := &Snapshot{
+		Version:  SnapshotVersion,
+		Dialect:  t.Dialector.Name(),
+		Database: t.Migrator().CurrentDatabase(),
+		Tables:   make([]*SnapshotTable, 0, len(tables)),
+	}
+
+	for _, tableName := range tables {
+		table := &SnapshotTable{Name: tableName}
+
+		// not every dialect supports TableType, the type is informative only
+		if tableType, err := t.GetTableType(tableName); err == nil && tableType != nil {
+			table.Type = tableType.Type()
+			table.Comment = optString(tableType.Comment())
+		}
+
+		columns, err := t.GetTableColumns(tableName)
+		if err != nil {
+			return nil, fmt.Errorf("table %s: %w", tableName, err)
+		}
+		for _, c := range columns {
+			column := &SnapshotColumn{
+				Name:         c.Name(),
+				DatabaseType: c.DatabaseTypeName(),
+				ColumnType:   optString(c.ColumnType.ColumnType()),
+				PrimaryKey:   optBool(c.PrimaryKey()),
+				Unique:       optBool(c.Unique()),
+				Nullable:     optBool(c.Nullable()),
+				Length:       optInt64(c.Length()),
+				Default:      optString(c.DefaultValue()),
+				Comment:      optString(c.Comment()),
+			}
+			column.AutoIncrement = optBool(c.AutoIncrement())
+			if precision, scale, ok := c.DecimalSize(); ok {
+				column.Precision, column.Scale = &precision, &scale
+			}
+			if st := c.ScanType(); st != nil {
+				column.ScanType = st.String()
+			}
+			table.Columns = append(table.Columns, column)
+		}
+
+		// gen ignores index errors as well, not every dialect supports GetIndexes
+		indexes, err := t.GetTableIndex(tableName)
+		if err != nil {
+			t.Logger.Warn(context.Background(), "GetTableIndex for %s,err=%s", tableName, err.Error())
+		}
+		for _, idx := range indexes {
+			table.Indexes = append(table.Indexes, &SnapshotIndex{
+				Name:       idx.Name(),
+				Columns:    idx.Columns(),
+				PrimaryKey: optBool(idx.PrimaryKey()),
+				Unique:     optBool(idx.Unique()),
+				Option:     idx.Option(),
+			})
+		}
+
+		fks, err := t.GetTableForeignKeys(tableName)
+		if err != nil {
+			t.Logger.Warn(context.Background(), "GetTableForeignKeys for %s,err=%s", tableName, err.Error())
+		}
+		table.ForeignKeys = fks
+
+		s.Tables = append(s.Tables, table)
+	}
+
+	return s, nil
+}
+
+func isJSONFile(path string) bool {
+	return strings.EqualFold(filepath.Ext(path), ".json")
+}
+
+// WriteSnapshotFile writes s as JSON when path ends with .json, YAML otherwise
+func WriteSnapshotFile(path string, s *Snapshot) error {
+	var (
+		content []byte
+		err     error
+	)
+	if isJSONFile(path) {
+		content, err = json.MarshalIndent(s, "", "  ")
+	} else {
+		content, err = yaml.Marshal(s)
+	}
+	if err != nil {
+		return err
+	}
+
+	if dir := filepath.Dir(path); dir != "" {
+		if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+			return err
+		}
+	}
+	return os.WriteFile(path, content, 0640)
+}
+
+func LoadSnapshotFile(path string) (*Snapshot, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var s Snapshot
+	if isJSONFile(path) {
+		err = json.Unmarshal(content, &s)
+	} else {
+		err = yaml.Unmarshal(content, &s)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("snapshot %s: %w", path, err)
+	}
+	if s.Version != SnapshotVersion {
+		return nil, fmt.Errorf("snapshot %s: unsupported version %q (support %q for now)", path, s.Version, SnapshotVersion)
+	}
+
+	return &s, nil
+}
+
+// OpenSnapshot returns a gorm.DB whose migrator answers from the snapshot file,
+// it cannot run any query
+func OpenSnapshot(path string) (*gorm.DB, error) {
+	s, err := LoadSnapshotFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return gorm.Open(&snapshotDialector{s}, &gorm.Config{})
+}
+
+// =================================================================================
+
+var snapshotScanTypes = map[string]reflect.Type{}
+
+func init() {
+	for _, v := range []interface{}{
+		false, int(0), int8(0), int16(0), int32(0), int64(0),
+		uint(0), uint8(0), uint16(0), uint32(0), uint64(0), float32(0), float64(0),
+		"", []byte(nil), time.Time{}, new(interface{}),
+		sql.NullBool{}, sql.NullByte{}, sql.NullFloat64{}, sql.NullInt16{}, sql.NullInt32{},
+		sql.NullInt64{}, sql.NullString{}, sql.NullTime{}, sql.RawBytes{},
+	} {
+		rt := reflect.TypeOf(v)
+		if rt.Kind() == reflect.Ptr {
+			rt = rt.Elem()
+		}
+		snapshotScanTypes[rt.String()] = rt
+	}
+}
+
+func snapshotScanType(name string) reflect.Type {
+	if name == "" {
+		return nil
+	}
+	if rt, ok := snapshotScanTypes[name]; ok {
+		return rt
+	}
+	return snapshotScanTypes["interface {}"]
+}
+
+type snapshotDialector struct {
+	snapshot *Snapshot
+}
+
+func (d *snapshotDialector) Name() string {
+	return d.snapshot.Dialect
+}
+
+func (d *snapshotDialector) Initialize(*gorm.DB) error {
+	return nil
+}
+
+func (d *snapshotDialector) Migrator(db *gorm.DB) gorm.Migrator {
+	return snapshotMigrator{
+		Migrator: gormmigrator.Migrator{Config: gormmigrator.Config{DB: db, Dialector: d}},
+		snapshot: d.snapshot,
+	}
+}
+
+func (d *snapshotDialector) DataTypeOf(*schema.Field) string {
+	return ""
+}
+
+func (d *snapshotDialector) DefaultValueOf(*schema.Field) clause.Expression {
+	return clause.Expr{SQL: "DEFAULT"}
+}
+
+func (d *snapshotDialector) BindVarTo(writer clause.Writer, stmt *gorm.Statement, v interface{}) {
+	writer.WriteByte('?')
+}
+
+func (d *snapshotDialector) QuoteTo(writer clause.Writer, str string) {
+	writer.WriteString(str)
+}
+
+func (d *snapshotDialector) Explain(sql string, vars ...interface{}) string {
+	return sql
+}
+
+type snapshotMigrator struct {
+	gormmigrator.Migrator
+	snapshot *Snapshot
+}
+
+func (m snapshotMigrator) table(dst interface{}) (*SnapshotTable, error) {
+	name, ok := dst.(string)
+	if !ok {
+		return nil, fmt.Errorf("snapshot only supports table names, got %T", dst)
+	}
+	for _, t := range m.snapshot.Tables {
+		if t.Name == name {
+			return t, nil
+		}
+	}
+	return nil, fmt.Errorf("table %s not found in snapshot", name)
+}
+
+func (m snapshotMigrator) CurrentDatabase() string {
+	return m.snapshot.Database
+}
+
+func (m snapshotMigrator) GetTables() (tableList []string, err error) {
+	for _, t := range m.snapshot.Tables {
+		tableList = append(tableList, t.Name)
+	}
+	return tableList, nil
+}
+
+func (m snapshotMigrator) HasTable(dst interface{}) bool {
+	_, err := m.table(dst)
+	return err == nil
+}
+
+func (m snapshotMigrator) TableType(dst interface{}) (gorm.TableType, error) {
+	t, err := m.table(dst)
+	if err != nil {
+		return nil, err
+	}
+	return gormmigrator.TableType{
+		NameValue:    t.Name,
+		TypeValue:    t.Type,
+		CommentValue: nullString(t.Comment),
+	}, nil
+}
+
+func (m snapshotMigrator) ColumnTypes(dst interface{}) ([]gorm.ColumnType, error) {
+	t, err := m.table(dst)
+	if err != nil {
+		return nil, err
+	}
+
+	columnTypes := make([]gorm.ColumnType, 0, len(t.Columns))
+	for _, c := range t.Columns {
+		columnTypes = append(columnTypes, snapshotColumnType{c})
+	}
+	return columnTypes, nil
+}
+
+func (m snapshotMigrator) GetIndexes(dst interface{}) ([]gorm.Index, error) {
+	t, err := m.table(dst)
+	if err != nil {
+		return nil, err
+	}
+
+	indexes := make([]gorm.Index, 0, len(t.Indexes))
+	for _, idx := range t.Indexes {
+		indexes = append(indexes, gormmigrator.Index{
+			TableName:       t.Name,
+			NameValue:       idx.Name,
+			ColumnList:      idx.Columns,
+			PrimaryKeyValue: nullBool(idx.PrimaryKey),
+			UniqueValue:     nullBool(idx.Unique),
+			OptionValue:     idx.Option,
+		})
+	}
+	return indexes, nil
+}
+
+// snapshotColumnType implements gorm.ColumnType, unlike migrator.ColumnType it never
+// falls back to a *sql.ColumnType
+type snapshotColumnType struct {
+	c *SnapshotColumn
+}
+
+func (ct snapshotColumnType) Name() string {
+	return ct.c.Name
+}
+
+func (ct snapshotColumnType) DatabaseTypeName() string {
+	return ct.c.DatabaseType
+}
+
+func (ct snapshotColumnType) ColumnType() (columnType string, ok bool) {
+	v := nullString(ct.c.ColumnType)
+	return v.String, v.Valid
+}
+
+func (ct snapshotColumnType) PrimaryKey() (isPrimaryKey bool, ok bool) {
+	v := nullBool(ct.c.PrimaryKey)
+	return v.Bool, v.Valid
+}
+
+func (ct snapshotColumnType) AutoIncrement() (isAutoIncrement bool, ok bool) {
+	v := nullBool(ct.c.AutoIncrement)
+	return v.Bool, v.Valid
+}
+
+func (ct snapshotColumnType) Length() (length int64, ok bool) {
+	if ct.c.Length == nil {
+		return 0, false
+	}
+	return *ct.c.Length, true
+}
+
+func (ct snapshotColumnType) DecimalSize() (precision int64, scale int64, ok bool) {
+	if ct.c.Precision == nil || ct.c.Scale == nil {
+		return 0, 0, false
+	}
+	return *ct.c.Precision, *ct.c.Scale, true
+}
+
+func (ct snapshotColumnType) Nullable() (nullable bool, ok bool) {
+	v := nullBool(ct.c.Nullable)
+	return v.Bool, v.Valid
+}
+
+func (ct snapshotColumnType) Unique() (unique bool, ok bool) {
+	v := nullBool(ct.c.Unique)
+	return v.Bool, v.Valid
+}
+
+func (ct snapshotColumnType) ScanType() reflect.Type {
+	return snapshotScanType(ct.c.ScanType)
+}
+
+func (ct snapshotColumnType) Comment() (value string, ok bool) {
+	v := nullString(ct.c.Comment)
+	return v.String, v.Valid
+}
+
+func (ct snapshotColumnType) DefaultValue() (value string, ok bool) {
+	v := nullString(ct.c.Default)
+	return v.String, v.Valid
+}
@@ -0,0 +1,178 @@
+package dataloader
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// roundTrips is a go-redis hook counting the commands and pipelines sent
+type roundTrips struct {
+	n int64
+}
+
+func (r *roundTrips) DialHook(next redis.DialHook) redis.DialHook {
+	return next
+}
+
+func (r *roundTrips) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		atomic.AddInt64(&r.n, 1)
+		return next(ctx, cmd)
+	}
+}
+
+func (r *roundTrips) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		atomic.AddInt64(&r.n, 1)
+		return next(ctx, cmds)
+	}
+}
+
+func (r *roundTrips) count() int64 {
+	return atomic.LoadInt64(&r.n)
+}
+
+// batchKeys inserts the datapokok 101..200 and returns their ids
+func (f *fixture) batchKeys(t testing.TB) []int32 {
+	t.Helper()
+
+	err := f.db.Exec(`WITH RECURSIVE n(i) AS (SELECT 101 UNION ALL SELECT i + 1 FROM n WHERE i < 200)
+		INSERT INTO datapokok (id, nip, nama, tglcatatan, email)
+		SELECT i, 'b' || i, 'B' || i, CURRENT_TIMESTAMP, 'b' || i || '@example.com' FROM n`).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keys := make([]int32, 0, 100)
+	for id := int32(101); id <= 200; id++ {
+		keys = append(keys, id)
+	}
+	return keys
+}
+
+// loadBatch loads keys with a new loader in one batch
+func (f *fixture) loadBatch(t testing.TB, keys []int32) {
+	t.Helper()
+
+	l := GetDatapokok_IDLoader(f.q, f.cache, LoaderOptions{MaxBatch: len(keys)})
+	_, errs := l.LoadAll(context.Background(), keys)
+	for i, err := range errs {
+		if err != nil {
+			t.Fatalf("key %d: %v", keys[i], err)
+		}
+	}
+}
+
+func TestRedisRoundTrips(t *testing.T) {
+	f := newFixture(t)
+	keys := f.batchKeys(t)
+	trips := &roundTrips{}
+	f.redis.AddHook(trips)
+
+	// one MGET, then one pipeline writing the records back
+	f.loadBatch(t, keys)
+	if n := trips.count(); n != 2 {
+		t.Errorf("miss of %d keys: got %d round trips, want 2", len(keys), n)
+	}
+
+	// one MGET
+	f.loadBatch(t, keys)
+	if n := trips.count() - 2; n != 1 {
+		t.Errorf("hit of %d keys: got %d round trips, want 1", len(keys), n)
+	}
+
+	// the lists of the foreign key loader, a hit is not written back either
+	for _, c := range []struct {
+		name  string
+		trips int64
+	}{{"miss", 2}, {"hit", 1}} {
+		before := trips.count()
+		_, errs := GetDatapendidikan_DatapokokIDLoader(f.q, f.cache).LoadAll(context.Background(), []int32{1, 2, 3})
+		for i, err := range errs {
+			if err != nil {
+				t.Fatalf("%s %d: %v", c.name, i+1, err)
+			}
+		}
+		if n := trips.count() - before; n != c.trips {
+			t.Errorf("foreign key %s: got %d round trips, want %d", c.name, n, c.trips)
+		}
+	}
+}
+
+func TestRingCache(t *testing.T) {
+	f := newFixture(t)
+	keys := f.batchKeys(t)
+
+	// MGET reaches one shard only, the ring spreads the keys over both
+	ring := redis.NewRing(&redis.RingOptions{Addrs: map[string]string{
+		"a": miniredis.RunT(t).Addr(),
+		"b": miniredis.RunT(t).Addr(),
+	}})
+	t.Cleanup(func() { ring.Close() })
+	f.cache = NewRedisCache(ring)
+
+	f.loadBatch(t, keys)
+	f.exec(t, "UPDATE datapokok SET nama = 'changed'")
+	recs, errs := GetDatapokok_IDLoader(f.q, f.cache, LoaderOptions{MaxBatch: len(keys)}).LoadAll(context.Background(), keys)
+	for i, rec := range recs {
+		if errs[i] != nil || rec == nil || rec.ID != keys[i] || rec.Nama == "changed" {
+			t.Fatalf("hit %d: got %+v, %v", keys[i], rec, errs[i])
+		}
+	}
+	if f.queries != 0 {
+		t.Errorf("hit: got %d queries, want 0", f.queries)
+	}
+
+	// a single DEL only reaches the shard of its first key
+	if err := InvalidateDatapokok(context.Background(), f.cache, recs...); err != nil {
+		t.Fatal(err)
+	}
+	recs, errs = GetDatapokok_IDLoader(f.q, f.cache, LoaderOptions{MaxBatch: len(keys)}).LoadAll(context.Background(), keys)
+	for i, rec := range recs {
+		if errs[i] != nil || rec == nil || rec.Nama != "changed" {
+			t.Fatalf("invalidated %d: got %+v, %v", keys[i], rec, errs[i])
+		}
+	}
+	if f.queries != 1 {
+		t.Errorf("invalidated: got %d queries, want 1", f.queries)
+	}
+}
+
+// BenchmarkRedisMiss loads 100 keys missing from redis per op
+func BenchmarkRedisMiss(b *testing.B) {
+	f := newFixture(b)
+	keys := f.batchKeys(b)
+	trips := &roundTrips{}
+	f.redis.AddHook(trips)
+
+	var n int64
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		f.redis.FlushAll(context.Background())
+		before := trips.count()
+		b.StartTimer()
+
+		f.loadBatch(b, keys)
+		n += trips.count() - before
+	}
+	b.ReportMetric(float64(n)/float64(b.N), "roundtrips/op")
+}
+
+// BenchmarkRedisHit loads 100 keys cached in redis per op
+func BenchmarkRedisHit(b *testing.B) {
+	f := newFixture(b)
+	keys := f.batchKeys(b)
+	f.loadBatch(b, keys)
+	trips := &roundTrips{}
+	f.redis.AddHook(trips)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		f.loadBatch(b, keys)
+	}
+	b.ReportMetric(float64(trips.count())/float64(b.N), "roundtrips/op")
+}
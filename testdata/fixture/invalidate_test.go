@@ -0,0 +1,146 @@
+package dataloader
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"example.com/fixture/out/model"
+)
+
+// newInvalidateFixture is newFixture with the InvalidatePlugin registered
+func newInvalidateFixture(t *testing.T) *fixture {
+	t.Helper()
+
+	f := newFixture(t)
+	if err := f.db.Use(NewInvalidatePlugin(f.cache)); err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+// reloaded checks the old rows were reloaded with the key columns only
+func (f *fixture) reloaded(t *testing.T, table, columns string) {
+	t.Helper()
+	for _, sql := range f.selects {
+		if strings.HasPrefix(sql, "SELECT "+columns+" FROM `"+table+"`") {
+			return
+		}
+	}
+	t.Errorf("no reload of %s from %s in %q", columns, table, f.selects)
+}
+
+func TestInvalidateSave(t *testing.T) {
+	f := newInvalidateFixture(t)
+	ctx := context.Background()
+
+	rec, err := GetDatapokok_IDLoader(f.q, f.cache).Load(ctx, 1)
+	if err != nil || rec == nil {
+		t.Fatalf("load: got %+v, %v", rec, err)
+	}
+	if _, err := GetDatapokok_NipLoader(f.q, f.cache).Load(ctx, "n1"); err != nil {
+		t.Fatal(err)
+	}
+
+	f.queries, f.selects = 0, nil
+	rec.Nip = "n1-saved"
+	if err := f.db.Save(rec).Error; err != nil {
+		t.Fatal(err)
+	}
+	f.reloaded(t, "datapokok", "`id`,`nip`")
+
+	// the new key is loaded again, the old one is gone
+	f.queries = 0
+	rec, err = GetDatapokok_IDLoader(f.q, f.cache).Load(ctx, 1)
+	if err != nil || rec == nil || rec.Nip != "n1-saved" {
+		t.Errorf("saved id: got %+v, %v", rec, err)
+	}
+	if rec, err := GetDatapokok_NipLoader(f.q, f.cache).Load(ctx, "n1"); !errors.Is(err, ErrNotFound) || rec != nil {
+		t.Errorf("old nip: got %+v, %v", rec, err)
+	}
+	if f.queries != 2 {
+		t.Errorf("got %d queries, want 2", f.queries)
+	}
+}
+
+func TestInvalidateUpdate(t *testing.T) {
+	f := newInvalidateFixture(t)
+	ctx := context.Background()
+
+	if _, err := GetDatapokok_NipLoader(f.q, f.cache).Load(ctx, "n2"); err != nil {
+		t.Fatal(err)
+	}
+
+	// an update through gen has conditions and no primary key
+	f.queries, f.selects = 0, nil
+	d := f.q.Datapokok
+	if _, err := d.WithContext(ctx).Where(d.ID.Eq(2)).Update(d.Nip, "n2-updated"); err != nil {
+		t.Fatal(err)
+	}
+	f.reloaded(t, "datapokok", "`id`,`nip`")
+
+	f.queries = 0
+	if rec, err := GetDatapokok_NipLoader(f.q, f.cache).Load(ctx, "n2"); !errors.Is(err, ErrNotFound) || rec != nil {
+		t.Errorf("old nip: got %+v, %v", rec, err)
+	}
+	if rec, err := GetDatapokok_NipLoader(f.q, f.cache).Load(ctx, "n2-updated"); err != nil || rec == nil || rec.ID != 2 {
+		t.Errorf("new nip: got %+v, %v", rec, err)
+	}
+	if f.queries != 2 {
+		t.Errorf("got %d queries, want 2", f.queries)
+	}
+}
+
+func TestInvalidateDelete(t *testing.T) {
+	f := newInvalidateFixture(t)
+	ctx := context.Background()
+
+	recs, err := GetDatapendidikan_DatapokokIDLoader(f.q, f.cache).Load(ctx, 2)
+	if err != nil || len(recs) != 1 {
+		t.Fatalf("load: got %d records, %v", len(recs), err)
+	}
+
+	f.queries, f.selects = 0, nil
+	p := f.q.Datapendidikan
+	if _, err := p.WithContext(ctx).Where(p.ID.Eq(3)).Delete(); err != nil {
+		t.Fatal(err)
+	}
+	f.reloaded(t, "datapendidikan", "`id`,`datapokok_id`")
+
+	f.queries = 0
+	recs, err = GetDatapendidikan_DatapokokIDLoader(f.q, f.cache).Load(ctx, 2)
+	if err != nil || len(recs) != 0 {
+		t.Errorf("deleted: got %d records, %v", len(recs), err)
+	}
+	if f.queries != 1 {
+		t.Errorf("got %d queries, want 1", f.queries)
+	}
+}
+
+func TestInvalidateCreate(t *testing.T) {
+	f := newInvalidateFixture(t)
+	ctx := context.Background()
+
+	rec, err := GetDatapokok_IDLoader(f.q, f.cache).Load(ctx, 9)
+	if !errors.Is(err, ErrNotFound) || rec != nil {
+		t.Fatalf("missing: got %+v, %v", rec, err)
+	}
+	f.cached(t, cacheKey("Datapokok", "ID", int32(9)))
+
+	err = f.q.Datapokok.WithContext(ctx).Create(&model.Datapokok{ID: 9, Nip: "n9", Nama: "I", Tglcatatan: time.Now(), Email: "i@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the negative entry is cleared
+	f.queries = 0
+	rec, err = GetDatapokok_IDLoader(f.q, f.cache).Load(ctx, 9)
+	if err != nil || rec == nil || rec.Nip != "n9" {
+		t.Errorf("created: got %+v, %v", rec, err)
+	}
+	if f.queries != 1 {
+		t.Errorf("got %d queries, want 1", f.queries)
+	}
+}
@@ -0,0 +1,279 @@
+package dataloader
+
+// The fixture tests are copied next to the loaders generated from
+// testdata/fixture by TestGeneratedLoaders of db2gorm, they never run in place
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"github.com/redis/go-redis/v9"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"example.com/fixture/out/orm"
+)
+
+type fixture struct {
+	db      *gorm.DB
+	q       *orm.Query
+	redis   *redis.Client
+	cache   Cache
+	queries int      // SELECT statements run against the database
+	selects []string // and their SQL
+}
+
+// newFixture opens a sqlite database with schema.sql and an empty redis
+func newFixture(t testing.TB) *fixture {
+	t.Helper()
+
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "fixture.db")), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ddl, err := os.ReadFile(filepath.Join("..", "..", "schema.sql"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Exec(string(ddl)).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	rc := redis.NewClient(&redis.Options{Addr: os.Getenv("DB2GORM_FIXTURE_REDIS")})
+	if err := rc.FlushAll(context.Background()).Err(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { rc.Close() })
+
+	f := &fixture{db: db, q: orm.Use(db), redis: rc, cache: NewRedisCache(rc)}
+	err = db.Callback().Query().After("gorm:query").Register("fixture:count", func(tx *gorm.DB) {
+		f.queries++
+		f.selects = append(f.selects, tx.Statement.SQL.String())
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+// exec changes the database behind the cache, a cached key keeps its old value
+func (f *fixture) exec(t *testing.T, sql string) {
+	t.Helper()
+	if err := f.db.Exec(sql).Error; err != nil {
+		t.Fatal(err)
+	}
+	f.queries, f.selects = 0, nil
+}
+
+func (f *fixture) cached(t *testing.T, key string) {
+	t.Helper()
+	if n, err := f.redis.Exists(context.Background(), key).Result(); err != nil || n != 1 {
+		t.Errorf("%s not cached (%d, %v)", key, n, err)
+	}
+}
+
+func TestPkLoaderCache(t *testing.T) {
+	f := newFixture(t)
+	ctx := context.Background()
+
+	recs, errs := GetDatapokok_IDLoader(f.q, f.cache).LoadAll(ctx, []int32{1, 2})
+	for i, id := range []int32{1, 2} {
+		if errs[i] != nil || recs[i] == nil || recs[i].ID != id {
+			t.Fatalf("miss %d: got %+v, %v", id, recs[i], errs[i])
+		}
+	}
+	if f.queries != 1 {
+		t.Errorf("miss: got %d queries, want 1", f.queries)
+	}
+	f.cached(t, cacheKey("Datapokok", "ID", int32(2)))
+
+	// 2 and 1 are hits still holding the old name, 3 is a miss
+	f.exec(t, "UPDATE datapokok SET nama = 'changed'")
+	recs, errs = GetDatapokok_IDLoader(f.q, f.cache).LoadAll(ctx, []int32{2, 1, 3})
+	for i, want := range []struct {
+		id   int32
+		nama string
+	}{{2, "B"}, {1, "A"}, {3, "changed"}} {
+		if errs[i] != nil || recs[i] == nil || recs[i].ID != want.id || recs[i].Nama != want.nama {
+			t.Errorf("key %d: got %+v, %v, want nama %q", want.id, recs[i], errs[i], want.nama)
+		}
+	}
+	if f.queries != 1 {
+		t.Errorf("hit: got %d queries, want 1 for the missing key", f.queries)
+	}
+}
+
+func TestUniqueLoaderCache(t *testing.T) {
+	f := newFixture(t)
+	ctx := context.Background()
+
+	rec, err := GetDatapokok_NipLoader(f.q, f.cache).Load(ctx, "n1")
+	if err != nil || rec == nil || rec.Nip != "n1" {
+		t.Fatalf("miss: got %+v, %v", rec, err)
+	}
+	f.cached(t, cacheKey("Datapokok", "Nip", "n1"))
+
+	f.exec(t, "UPDATE datapokok SET nama = 'changed'")
+	recs, errs := GetDatapokok_NipLoader(f.q, f.cache).LoadAll(ctx, []string{"n3", "n1"})
+	if errs[0] != nil || recs[0].Nip != "n3" || recs[0].Nama != "changed" {
+		t.Errorf("miss n3: got %+v, %v", recs[0], errs[0])
+	}
+	if errs[1] != nil || recs[1].Nip != "n1" || recs[1].Nama != "A" {
+		t.Errorf("hit n1: got %+v, %v", recs[1], errs[1])
+	}
+	if f.queries != 1 {
+		t.Errorf("got %d queries, want 1 for n3", f.queries)
+	}
+}
+
+func TestNpkLoaderCache(t *testing.T) {
+	f := newFixture(t)
+	ctx := context.Background()
+
+	lists, errs := GetDatapendidikan_DatapokokIDLoader(f.q, f.cache).LoadAll(ctx, []int32{1, 2})
+	for i, want := range []int{2, 1} {
+		if errs[i] != nil || len(lists[i]) != want {
+			t.Fatalf("miss %d: got %d records, %v, want %d", i+1, len(lists[i]), errs[i], want)
+		}
+		for _, rec := range lists[i] {
+			if rec.DatapokokID != int32(i+1) {
+				t.Errorf("miss %d: got a record of %d", i+1, rec.DatapokokID)
+			}
+		}
+	}
+	f.cached(t, cacheKey("Datapendidikan", "DatapokokID", int32(1)))
+
+	f.exec(t, "UPDATE datapendidikan SET datapokok_id = 3 WHERE id = 2")
+	lists, errs = GetDatapendidikan_DatapokokIDLoader(f.q, f.cache).LoadAll(ctx, []int32{2, 1, 3})
+	for i, want := range []struct {
+		key int32
+		n   int
+	}{{2, 1}, {1, 2}, {3, 1}} {
+		if errs[i] != nil || len(lists[i]) != want.n {
+			t.Errorf("key %d: got %d records, %v, want %d", want.key, len(lists[i]), errs[i], want.n)
+		}
+		if want.key != 1 {
+			for _, rec := range lists[i] {
+				if rec.DatapokokID != want.key {
+					t.Errorf("key %d: got a record of %d", want.key, rec.DatapokokID)
+				}
+			}
+		}
+	}
+	if f.queries != 1 {
+		t.Errorf("got %d queries, want 1 for key 3", f.queries)
+	}
+}
+
+func TestCompositeLoaderCache(t *testing.T) {
+	f := newFixture(t)
+	ctx := context.Background()
+
+	keys := []Riwayat_DatapokokIDUrutKey{{DatapokokID: 1, Urut: 2}, {DatapokokID: 1, Urut: 1}}
+	recs, errs := GetRiwayat_DatapokokIDUrutLoader(f.q, f.cache).LoadAll(ctx, keys)
+	for i, key := range keys {
+		if errs[i] != nil || recs[i] == nil || recs[i].DatapokokID != key.DatapokokID || recs[i].Urut != key.Urut {
+			t.Fatalf("miss %+v: got %+v, %v", key, recs[i], errs[i])
+		}
+	}
+	f.cached(t, cacheKey("Riwayat", "DatapokokIDUrut", keys[0]))
+
+	f.exec(t, "UPDATE riwayat SET jabatan = jabatan || '-changed'")
+	keys = []Riwayat_DatapokokIDUrutKey{{DatapokokID: 1, Urut: 1}, {DatapokokID: 1, Urut: 2}}
+	recs, errs = GetRiwayat_DatapokokIDUrutLoader(f.q, f.cache).LoadAll(ctx, keys)
+	for i, want := range []string{"staf", "kepala"} {
+		if errs[i] != nil || recs[i] == nil || recs[i].Urut != keys[i].Urut || recs[i].Jabatan == nil || *recs[i].Jabatan != want {
+			t.Errorf("hit %+v: got %+v, %v, want jabatan %q", keys[i], recs[i], errs[i], want)
+		}
+	}
+	if f.queries != 0 {
+		t.Errorf("hit: got %d queries, want 0", f.queries)
+	}
+
+	// a nullable column of a unique key
+	rec, err := GetRiwayat_DatapokokIDJabatanLoader(f.q, f.cache).Load(ctx, Riwayat_DatapokokIDJabatanKey{DatapokokID: 1, Jabatan: "staf-changed"})
+	if err != nil || rec == nil || rec.Urut != 1 {
+		t.Errorf("miss jabatan: got %+v, %v", rec, err)
+	}
+	if f.queries != 1 {
+		t.Errorf("miss jabatan: got %d queries, want 1", f.queries)
+	}
+}
+
+func TestFailedChunk(t *testing.T) {
+	f := newFixture(t)
+	keys := f.batchKeys(t)
+
+	// every query fails, the chunks running when the first one fails may still
+	// finish but no other chunk is started
+	broken := errors.New("broken")
+	var attempts int64
+	err := f.db.Callback().Query().Before("gorm:query").Register("fixture:fail", func(tx *gorm.DB) {
+		atomic.AddInt64(&attempts, 1)
+		tx.AddError(broken)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	o := LoaderOptions{MaxBatch: len(keys), ChunkSize: 10, Concurrency: 2}
+	recs, errs := GetDatapokok_IDLoader(f.q, f.cache, o).LoadAll(context.Background(), keys)
+	for i, err := range errs {
+		if recs[i] != nil || !errors.Is(err, ErrDatabase) || !errors.Is(err, broken) {
+			t.Fatalf("key %d: got %+v, %v, want a database error", keys[i], recs[i], err)
+		}
+	}
+	if n := atomic.LoadInt64(&attempts); n > int64(o.Concurrency) {
+		t.Errorf("got %d queries of %d chunks, want at most %d", n, len(keys)/o.ChunkSize, o.Concurrency)
+	}
+}
+
+func TestNegativeCache(t *testing.T) {
+	f := newFixture(t)
+	ctx := context.Background()
+
+	rec, err := GetDatapokok_IDLoader(f.q, f.cache).Load(ctx, 9)
+	var nf *NotFoundError
+	if rec != nil || !errors.Is(err, ErrNotFound) || !errors.As(err, &nf) || nf.Key != int32(9) {
+		t.Fatalf("miss: got %+v, %v, want a NotFoundError of 9", rec, err)
+	}
+	if f.queries != 1 {
+		t.Errorf("miss: got %d queries, want 1", f.queries)
+	}
+	f.cached(t, cacheKey("Datapokok", "ID", int32(9)))
+
+	// the negative entry hides a row inserted behind the cache until it expires
+	f.exec(t, "INSERT INTO datapokok (id, nip, nama, tglcatatan, email) VALUES (9, 'n9', 'I', CURRENT_TIMESTAMP, 'i@example.com')")
+	rec, err = GetDatapokok_IDLoader(f.q, f.cache).Load(ctx, 9)
+	if rec != nil || !errors.Is(err, ErrNotFound) {
+		t.Errorf("negative hit: got %+v, %v", rec, err)
+	}
+	if f.queries != 0 {
+		t.Errorf("negative hit: got %d queries, want 0", f.queries)
+	}
+}
+
+func TestNegativeCacheOff(t *testing.T) {
+	f := newFixture(t)
+	ctx := context.Background()
+	off := LoaderOptions{NegativeCacheTTL: -1}
+
+	for i := 0; i < 2; i++ {
+		f.queries = 0
+		rec, err := GetDatapokok_IDLoader(f.q, f.cache, off).Load(ctx, 9)
+		if rec != nil || !errors.Is(err, ErrNotFound) {
+			t.Errorf("load %d: got %+v, %v", i+1, rec, err)
+		}
+		if f.queries != 1 {
+			t.Errorf("load %d: got %d queries, want 1", i+1, f.queries)
+		}
+	}
+	if n, err := f.redis.Exists(ctx, cacheKey("Datapokok", "ID", int32(9))).Result(); err != nil || n != 0 {
+		t.Errorf("negative entry written (%d, %v)", n, err)
+	}
+}
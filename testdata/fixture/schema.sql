@@ -0,0 +1,31 @@
+CREATE TABLE datapokok (
+  id integer PRIMARY KEY,
+  nip varchar(20) NOT NULL,
+  nama text NOT NULL,
+  tglcatatan datetime NOT NULL,
+  email varchar(50) NOT NULL,
+  alias TEXT NOT NULL DEFAULT ''
+);
+CREATE UNIQUE INDEX uq_datapokok_nip ON datapokok (nip);
+CREATE INDEX idx_datapokok_nama ON datapokok (nama);
+
+CREATE TABLE datapendidikan (
+  id integer PRIMARY KEY,
+  datapokok_id integer NOT NULL REFERENCES datapokok (id),
+  jenjang varchar(10) NOT NULL DEFAULT 'S1'
+);
+
+CREATE TABLE riwayat (
+  datapokok_id INTEGER NOT NULL,
+  urut INTEGER NOT NULL,
+  jabatan TEXT,
+  PRIMARY KEY (datapokok_id, urut)
+);
+CREATE UNIQUE INDEX uq_riwayat_jabatan ON riwayat (datapokok_id, jabatan);
+
+INSERT INTO datapokok (id, nip, nama, tglcatatan, email) VALUES
+  (1, 'n1', 'A', CURRENT_TIMESTAMP, 'a@example.com'),
+  (2, 'n2', 'B', CURRENT_TIMESTAMP, 'b@example.com'),
+  (3, 'n3', 'C', CURRENT_TIMESTAMP, 'c@example.com');
+INSERT INTO datapendidikan (id, datapokok_id, jenjang) VALUES (1, 1, 'S1'), (2, 1, 'S2'), (3, 2, 'S1');
+INSERT INTO riwayat (datapokok_id, urut, jabatan) VALUES (1, 1, 'staf'), (1, 2, 'kepala'), (2, 1, NULL);